@@ -1,13 +1,17 @@
 package gui
 
 import (
+	"cmp"
 	"fmt"
 	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
 	"hmcalister/SmoothedParticleHydrodynamicsSimulation/particle"
 	"log"
+	"math"
+	"slices"
 
 	"github.com/veandco/go-sdl2/sdl"
 	"github.com/veandco/go-sdl2/ttf"
+	"gonum.org/v1/gonum/mat"
 )
 
 type GUIConfig struct {
@@ -23,6 +27,12 @@ func InitGUI(simulationConfig *config.SimulationConfig) (*GUIConfig, error) {
 	guiConfig := &GUIConfig{}
 	guiConfig.simulationConfig = simulationConfig
 
+	switch simulationConfig.ViewMode {
+	case "Projection", "Slice":
+	default:
+		log.Panicf("unknown view mode %q", simulationConfig.ViewMode)
+	}
+
 	err = sdl.Init(sdl.INIT_EVERYTHING)
 	if err != nil {
 		return nil, err
@@ -68,9 +78,43 @@ func (guiConfig *GUIConfig) setColorByParticleColorMap(particleColorMap float64)
 	}
 }
 
+func (guiConfig *GUIConfig) setColorByPhase(phaseIndex int) {
+	phaseColor := guiConfig.simulationConfig.Phases[phaseIndex].Color
+	guiConfig.renderer.SetDrawColor(phaseColor[0], phaseColor[1], phaseColor[2], 0)
+}
+
+// Get the indices of the particles to draw, in the order to draw them.
+//
+// In two dimensions every particle is drawn. In three dimensions the view looks along the z axis, so particles are
+// drawn from the back (largest z) to the front, and with the "Slice" ViewMode only particles in the slice are drawn.
+func (guiConfig *GUIConfig) particleDrawOrder(particles []*particle.Particle) []int {
+	simulationConfig := guiConfig.simulationConfig
+	drawOrder := make([]int, 0, len(particles))
+	for particleIndex, p := range particles {
+		if simulationConfig.Dimensions == 3 && simulationConfig.ViewMode == "Slice" &&
+			math.Abs(p.Position.AtVec(2)-simulationConfig.SlicePosition) > simulationConfig.SliceThickness/2 {
+			continue
+		}
+		drawOrder = append(drawOrder, particleIndex)
+	}
+
+	if simulationConfig.Dimensions == 3 {
+		slices.SortStableFunc(drawOrder, func(particleIndexA int, particleIndexB int) int {
+			return cmp.Compare(particles[particleIndexB].Position.AtVec(2), particles[particleIndexA].Position.AtVec(2))
+		})
+	}
+	return drawOrder
+}
+
+// Draw each particle, colored by the color map unless the ColorMode is "Phase"
 func (guiConfig *GUIConfig) DrawParticles(particles []*particle.Particle, particleColorMap []float64) {
-	for particleIndex, particle := range particles {
-		guiConfig.setColorByParticleColorMap(particleColorMap[particleIndex])
+	for _, particleIndex := range guiConfig.particleDrawOrder(particles) {
+		particle := particles[particleIndex]
+		if guiConfig.simulationConfig.ColorMode == "Phase" {
+			guiConfig.setColorByPhase(particle.Phase)
+		} else {
+			guiConfig.setColorByParticleColorMap(particleColorMap[particleIndex])
+		}
 		rect := sdl.Rect{
 			X: int32(particle.Position.AtVec(0)),
 			Y: int32(particle.Position.AtVec(1)),
@@ -81,6 +125,57 @@ func (guiConfig *GUIConfig) DrawParticles(particles []*particle.Particle, partic
 	}
 }
 
+// Draw the outline of each rigid body
+func (guiConfig *GUIConfig) DrawRigidBodies(rigidBodies []*particle.RigidBody) {
+	guiConfig.renderer.SetDrawColor(255, 255, 255, 0)
+	for _, rigidBody := range rigidBodies {
+		guiConfig.drawOutline(rigidBody.Outline())
+	}
+}
+
+// Draw the outline of each obstacle
+func (guiConfig *GUIConfig) DrawObstacles(obstacles []*particle.Obstacle) {
+	guiConfig.renderer.SetDrawColor(160, 160, 160, 0)
+	for _, obstacle := range obstacles {
+		guiConfig.drawOutline(obstacle.Outline())
+	}
+}
+
+// Draw a closed outline through the given points
+func (guiConfig *GUIConfig) drawOutline(outline []*mat.VecDense) {
+	points := make([]sdl.Point, len(outline)+1)
+	for pointIndex, point := range outline {
+		points[pointIndex] = sdl.Point{X: int32(point.AtVec(0)), Y: int32(point.AtVec(1))}
+	}
+	points[len(outline)] = points[0]
+	guiConfig.renderer.DrawLines(points)
+}
+
+// Draw an arrow in the top right corner of the window pointing in the direction of gravity
+func (guiConfig *GUIConfig) DrawGravity(gravityX float64, gravityY float64) {
+	gravityStrength := math.Hypot(gravityX, gravityY)
+	if gravityStrength == 0 {
+		return
+	}
+
+	arrowLength := 30.0
+	directionX, directionY := gravityX/gravityStrength, gravityY/gravityStrength
+	tailX, tailY := float64(guiConfig.simulationConfig.SimulationWidth)-2*arrowLength, 2*arrowLength
+	tipX, tipY := tailX+arrowLength*directionX, tailY+arrowLength*directionY
+
+	// The head is two lines back from the tip, each turned a little from the direction of the arrow
+	headLength := arrowLength / 3
+	points := []sdl.Point{
+		{X: int32(tailX), Y: int32(tailY)},
+		{X: int32(tipX), Y: int32(tipY)},
+		{X: int32(tipX - headLength*(directionX-directionY/2)), Y: int32(tipY - headLength*(directionY+directionX/2))},
+		{X: int32(tipX), Y: int32(tipY)},
+		{X: int32(tipX - headLength*(directionX+directionY/2)), Y: int32(tipY - headLength*(directionY-directionX/2))},
+	}
+	guiConfig.renderer.SetDrawColor(255, 255, 255, 0)
+	guiConfig.renderer.DrawLines(points)
+}
+
 func (guiConfig *GUIConfig) DisplayFPSText(currentFPS float64) {
 	textColor := sdl.Color{
 		R: 255,
@@ -35,3 +35,23 @@ func ReadConfigYaml(yamlFilePath string) (*SimulationConfig, error) {
 	simulationConfig.finalizeConfig()
 	return simulationConfig, nil
 }
+
+// Unmarshal the config, remembering which keys were given
+func (simulationConfig *SimulationConfig) UnmarshalYAML(value *yaml.Node) error {
+	// Decode into a type without this method, to avoid recursing
+	type simulationConfigFields SimulationConfig
+	if err := value.Decode((*simulationConfigFields)(simulationConfig)); err != nil {
+		return err
+	}
+	simulationConfig.specifiedKeys = mappingKeys(value)
+	return nil
+}
+
+// Get the set of keys of a YAML mapping
+func mappingKeys(value *yaml.Node) map[string]bool {
+	keys := make(map[string]bool)
+	for keyIndex := 0; keyIndex < len(value.Content); keyIndex += 2 {
+		keys[value.Content[keyIndex].Value] = true
+	}
+	return keys
+}
@@ -14,11 +14,127 @@ type SimulationConfig struct {
 	ParticleMass float64 `default:"1.0" yaml:"ParticleMass"`
 	ParticleSize int32   `default:"5" yaml:"ParticleSize"`
 
-	FluidTargetDensity          float64 `default:"1.0" yaml:"FluidTargetDensity"`
-	PressureCoefficient         float64 `default:"1.0" yaml:"PressureCoefficient"`
-	ViscosityCoefficient        float64 `default:"0.0" yaml:"ViscosityCoefficient"`
-	CollisionDampingCoefficient float64 `default:"0.0" yaml:"CollisionDampingCoefficient"`
-	GravityStrength             float64 `default:"1.0" yaml:"GravityStrength"`
+	// The equation of state relating density to pressure. One of "Linear", "IdealGas", or "Tait".
+	// Linear and IdealGas are scaled by PressureCoefficient, while Tait is scaled by SpeedOfSound and TaitGamma and is clamped at zero below rest density
+	EquationOfState string  `default:"Linear" yaml:"EquationOfState"`
+	SpeedOfSound    float64 `default:"10.0" yaml:"SpeedOfSound"`
+	TaitGamma       float64 `default:"7.0" yaml:"TaitGamma"`
+
+	FluidTargetDensity  float64 `default:"1.0" yaml:"FluidTargetDensity"`
+	PressureCoefficient float64 `default:"1.0" yaml:"PressureCoefficient"`
+
+	// Double density relaxation (Clavet et al. 2005) adds a near pressure of NearPressureCoefficient times the near density,
+	// which is calculated with the Spiky kernel. This is a short range repulsion that stops particles clumping together.
+	// PCISPH, DFSPH, and PBF apply it along with the other non-pressure accelerations at the start of each step
+	NearPressureCoefficient float64 `default:"0.0" yaml:"NearPressureCoefficient"`
+
+	// The dynamic viscosity μ, so the viscous acceleration of a particle is μ/ρ ∇²v, with the Laplacian from the ViscosityKernel
+	ViscosityCoefficient         float64 `default:"0.0" yaml:"ViscosityCoefficient"`
+	SurfaceTensionCoefficient    float64 `default:"0.0" yaml:"SurfaceTensionCoefficient"`
+	CollisionDampingCoefficient  float64 `default:"0.0" yaml:"CollisionDampingCoefficient"`
+	CollisionFrictionCoefficient float64 `default:"0.0" yaml:"CollisionFrictionCoefficient"`
+	GravityStrength              float64 `default:"1.0" yaml:"GravityStrength"`
+
+	// How GravityStrength acts on each particle. One of "ForcePerVolume", where GravityStrength is a force per unit volume,
+	// so each particle (or rigid body) is accelerated by GravityStrength divided by its density, or "Acceleration",
+	// where every particle and rigid body is accelerated by GravityStrength regardless of its density.
+	// With ForcePerVolume the weight of any fluid is balanced by the same pressure gradient, so phases and rigid bodies
+	// of different densities only sink or float with Acceleration. To switch a config to Acceleration and keep the same
+	// motion at rest density, divide GravityStrength by the rest density (e.g. 0.00001 / 0.0025 = 0.004)
+	GravityModel string `default:"ForcePerVolume" yaml:"GravityModel"`
+
+	// The direction of gravity, as the angle (in radians) from straight down, turning counterclockwise as seen on screen,
+	// so π/2 pulls particles to the right. Tilting gravity one way is equivalent to tilting the container the other way.
+	// GravityMotion turns gravity over time, starting from GravityAngle: "Oscillation" rocks gravity back and forth by
+	// AngleAmplitude (as in a sloshing tank), "Rotation" turns it at AngularVelocity, and "Keyframes" follows the Angle of
+	// each keyframe (so a sudden flip is two keyframes close together in time). Any positions of the motion are ignored.
+	// The left and right arrow keys also tilt gravity by GravityTiltStep towards the left or right of the window
+	GravityAngle    float64      `default:"0.0" yaml:"GravityAngle"`
+	GravityMotion   MotionConfig `yaml:"GravityMotion"`
+	GravityTiltStep float64      `default:"0.0873" yaml:"GravityTiltStep"`
+
+	// How the viscosity of each phase depends on the local shear rate γ̇. One of "Newtonian", where the viscosity is constant,
+	// "PowerLaw", K γ̇^(n-1), "Carreau", μ∞ + (μ0 - μ∞)(1 + (λγ̇)^2)^((n-1)/2), "Cross", μ∞ + (μ0 - μ∞) / (1 + (λγ̇)^(1-n)),
+	// or "Bingham", a Bingham plastic that only flows once the stress exceeds YieldStress, regularized (Papanastasiou 1987)
+	// as μp + τy (1 - exp(-m γ̇)) / γ̇ where m is the YieldRegularization. The viscosity of each phase is used as K, μ0, or μp,
+	// and the FlowBehaviorIndex n is below one for shear thinning fluids (ketchup, paint) and above one for shear thickening fluids.
+	// As most models are unbounded as the shear rate approaches zero, the viscosity is limited to MaximumViscosity.
+	// Each of these options is only the default for phases that do not give their own
+	ViscosityModel         string  `default:"Newtonian" yaml:"ViscosityModel"`
+	FlowBehaviorIndex      float64 `default:"0.5" yaml:"FlowBehaviorIndex"`
+	InfiniteShearViscosity float64 `default:"0.0" yaml:"InfiniteShearViscosity"`
+	RelaxationTime         float64 `default:"1.0" yaml:"RelaxationTime"`
+	YieldStress            float64 `default:"0.0" yaml:"YieldStress"`
+	YieldRegularization    float64 `default:"100.0" yaml:"YieldRegularization"`
+	MaximumViscosity       float64 `default:"1.0" yaml:"MaximumViscosity"`
+
+	// Vorticity confinement (Fedkiw et al. 2001) restores the small swirls that numerical dissipation removes,
+	// by accelerating particles around the center of each vortex. The acceleration is the vorticity scaled by
+	// VorticityConfinementCoefficient and the SmoothingKernelRadius, so only small coefficients (around 0.01) are needed.
+	// Larger coefficients add energy faster than viscosity removes it
+	VorticityConfinementCoefficient float64 `default:"0.0" yaml:"VorticityConfinementCoefficient"`
+
+	// The fluid phases to simulate, each with its own particle mass, rest density, and viscosity.
+	// If no phases are given, a single phase is made from NumParticles, ParticleMass,
+	// FluidTargetDensity, and ViscosityCoefficient. Otherwise NumParticles should be left out, as it is replaced
+	// by the total number of particles over all phases
+	Phases []PhaseConfig `yaml:"Phases"`
+
+	// The strength of the artificial stress (Monaghan 2000) between particles of elastoplastic solid phases,
+	// which keeps particles under tension from clumping together and tearing the solid apart
+	ArtificialStressCoefficient float64 `default:"0.3" yaml:"ArtificialStressCoefficient"`
+
+	// Rigid bodies that float, sink, and tumble in the fluid. Each body is filled with boundary particles,
+	// whatever the BoundaryMode, and is pushed by the pressure and viscosity of the particles near it.
+	// Bodies collide with obstacles and the edges of the simulation, but not with each other
+	RigidBodies []RigidBodyConfig `yaml:"RigidBodies"`
+
+	// Obstacles inside the simulation, either static or moving along prescribed trajectories. Particles that hit
+	// an obstacle bounce off with CollisionDampingCoefficient, relative to the velocity of the surface of the obstacle,
+	// and are slowed along the surface by CollisionFrictionCoefficient
+	Obstacles []ObstacleConfig `yaml:"Obstacles"`
+
+	// Emitters that add particles to the simulation, and sinks that remove any particles inside them,
+	// such as the outflow of an open channel. Emitters stop adding particles while the simulation holds MaxParticles
+	Emitters     []EmitterConfig `yaml:"Emitters"`
+	Sinks        []RegionConfig  `yaml:"Sinks"`
+	MaxParticles int             `default:"5000" yaml:"MaxParticles"`
+
+	// External force fields, such as attractors, whirlpools, fans, and drag, that act on the particles in addition to gravity
+	ForceFields []ForceFieldConfig `yaml:"ForceFields"`
+
+	// Heat transfer. Each particle carries a temperature, starting at InitialTemperature, that is conducted between
+	// neighboring particles at the ThermalDiffusivity and changed by any heat sources. Following the Boussinesq
+	// approximation, gravity on each particle is scaled by 1 - ThermalExpansionCoefficient * (T - ReferenceTemperature),
+	// so particles warmer than ReferenceTemperature rise and cooler particles sink
+	InitialTemperature          float64            `default:"0.0" yaml:"InitialTemperature"`
+	ReferenceTemperature        float64            `default:"0.0" yaml:"ReferenceTemperature"`
+	ThermalDiffusivity          float64            `default:"0.0" yaml:"ThermalDiffusivity"`
+	ThermalExpansionCoefficient float64            `default:"0.0" yaml:"ThermalExpansionCoefficient"`
+	HeatSources                 []HeatSourceConfig `yaml:"HeatSources"`
+
+	// How particles are kept inside the simulation. One of "Reflect", which places particles that leave the simulation
+	// a random distance back inside, or "BoundaryParticles", which also places fixed boundary particles along the edges
+	// and obstacles that add to the density and pressure of nearby particles (Akinci et al. 2012). Rigid bodies use boundary particles in either mode.
+	// BoundaryParticleSpacing is the distance between boundary particles. If zero, the smallest rest spacing of
+	// any phase is used, or half the SmoothingKernelRadius if that is smaller
+	BoundaryMode            string  `default:"Reflect" yaml:"BoundaryMode"`
+	BoundaryParticleSpacing float64 `default:"0" yaml:"BoundaryParticleSpacing"`
+
+	// The number of dimensions of the simulation, either 2 or 3. In three dimensions the simulation is a box
+	// SimulationDepth deep along the z axis. Obstacles, rigid bodies, and the "BoundaryParticles" BoundaryMode
+	// are only supported in two dimensions, and a three dimensional simulation using any of them panics when created.
+	// Gravity, vortex force fields, and the interaction point act within the x-y plane, while regions, sinks,
+	// and heat sources extend through the entire depth of the simulation
+	Dimensions      int   `default:"2" yaml:"Dimensions"`
+	SimulationDepth int32 `default:"512" yaml:"SimulationDepth"`
+
+	// Periodic boundaries along each axis. Along a periodic axis, particles leaving one edge of the simulation
+	// re-enter at the opposite edge, and particles near opposite edges interact across the seam.
+	// PeriodicZ is only used in three dimensions
+	PeriodicX bool `default:"false" yaml:"PeriodicX"`
+	PeriodicY bool `default:"false" yaml:"PeriodicY"`
+	PeriodicZ bool `default:"false" yaml:"PeriodicZ"`
 
 	// Simulation Meta Config ---------------------------------------------------------------------
 
@@ -26,29 +142,113 @@ type SimulationConfig struct {
 	StepsPerFrame              int     `default:"1" yaml:"StepsPerFrame"`
 	SimulationNumWorkerThreads int     `default:"8" yaml:"SimulationNumWorkerThreads"`
 	SmoothingKernelRadius      float64 `default:"20" yaml:"SmoothingKernelRadius"`
-	// If random seed is set to 0, then a random seed is generated instead
+	// If random seed is set to 0, then a random seed is generated instead.
+	// A given seed gives the same simulation for any number of worker threads
 	RandomSeed uint64 `default:"0" yaml:"RandomSeed"`
 
+	// The smoothing kernels used for the density, pressure, and viscosity calculations.
+	// Each is one of "Power", "Poly6", "Spiky", "CubicSpline", "QuinticSpline", "WendlandC2", or "WendlandC4".
+	// The Power kernel is (1-r/h)^PowerKernelExponent. The ViscosityKernel may also be "Viscosity" (Müller et al. 2003),
+	// the only kernel whose Laplacian is positive everywhere, so the viscosity of other kernels can add energy to close particles
+	DensityKernel       string  `default:"Power" yaml:"DensityKernel"`
+	PressureKernel      string  `default:"Power" yaml:"PressureKernel"`
+	ViscosityKernel     string  `default:"Viscosity" yaml:"ViscosityKernel"`
+	PowerKernelExponent float64 `default:"2" yaml:"PowerKernelExponent"`
+
+	// The solver used to advance particles each step. One of "Explicit", "PCISPH", "DFSPH", or "PBF".
+	// The explicit solver calculates pressure directly from the equation of state, while PCISPH and DFSPH iterate
+	// on the pressure until the relative density error is below PressureSolverTolerance
+	Solver                      string  `default:"Explicit" yaml:"Solver"`
+	PressureSolverTolerance     float64 `default:"0.01" yaml:"PressureSolverTolerance"`
+	PressureSolverMinIterations int     `default:"3" yaml:"PressureSolverMinIterations"`
+	PressureSolverMaxIterations int     `default:"50" yaml:"PressureSolverMaxIterations"`
+
+	// DFSPH additionally iterates on the velocities until the relative density change over a step
+	// due to the divergence of the velocity field is below DivergenceSolverTolerance
+	DivergenceSolverEnabled       bool    `default:"true" yaml:"DivergenceSolverEnabled"`
+	DivergenceSolverTolerance     float64 `default:"0.1" yaml:"DivergenceSolverTolerance"`
+	DivergenceSolverMaxIterations int     `default:"50" yaml:"DivergenceSolverMaxIterations"`
+
+	// Position based fluids ("PBF") instead moves particles directly to satisfy the density constraint,
+	// for a fixed number of iterations. PBFRelaxation softens the constraint to avoid instability, while
+	// the tensile terms add an artificial pressure, -k (W(r)/W(Δq))^n, where Δq = PBFTensileDistance * SmoothingKernelRadius,
+	// that keeps particles from clustering. XSPHViscosity blends the velocity of each particle towards that of its neighbors
+	PBFIterations      int     `default:"4" yaml:"PBFIterations"`
+	PBFRelaxation      float64 `default:"0.0001" yaml:"PBFRelaxation"`
+	PBFTensileStrength float64 `default:"0.1" yaml:"PBFTensileStrength"`
+	PBFTensileExponent float64 `default:"4" yaml:"PBFTensileExponent"`
+	PBFTensileDistance float64 `default:"0.2" yaml:"PBFTensileDistance"`
+	XSPHViscosity      float64 `default:"0.01" yaml:"XSPHViscosity"`
+
+	// The time integration scheme used by the explicit solver to advance particles each step.
+	// One of "SymplecticEuler", "VelocityVerlet" (or equivalently "Leapfrog"), or "RK4"
+	Integrator string `default:"SymplecticEuler" yaml:"Integrator"`
+
+	// If true, SimulationStepSize is ignored and each step instead uses the largest stable step size
+	// found from the particle velocities, accelerations, and the viscosity coefficient.
+	// Each criterion is scaled by its safety factor, and the result is clamped between the min and max step size
+	AdaptiveTimeStepping  bool    `default:"false" yaml:"AdaptiveTimeStepping"`
+	CFLSafetyFactor       float64 `default:"0.4" yaml:"CFLSafetyFactor"`
+	ForceSafetyFactor     float64 `default:"0.25" yaml:"ForceSafetyFactor"`
+	ViscositySafetyFactor float64 `default:"0.125" yaml:"ViscositySafetyFactor"`
+	MinimumStepSize       float64 `default:"0.01" yaml:"MinimumStepSize"`
+	MaximumStepSize       float64 `default:"5.0" yaml:"MaximumStepSize"`
+
 	// GUI Config ---------------------------------------------------------------------------------
 
 	SimulationWidth  int32   `default:"1024" yaml:"SimulationWidth"`
 	SimulationHeight int32   `default:"512" yaml:"SimulationHeight"`
 	FramesPerSecond  float64 `default:"60" yaml:"FramesPerSecond"`
 
+	// How particles are colored. One of "Density", which shows the relative density error of each particle,
+	// "Phase", which uses the color of the phase of each particle, "Temperature", which shows the temperature
+	// of each particle relative to the ReferenceTemperature, or "Vorticity", which shows the vorticity of each particle
+	// relative to the largest vorticity (signed, so clockwise and counterclockwise differ, in two dimensions)
+	ColorMode string `default:"Density" yaml:"ColorMode"`
+
+	// How a three dimensional simulation is shown. One of "Projection", which shows every particle looking along
+	// the z axis, or "Slice", which only shows particles within SliceThickness / 2 of SlicePosition along the z axis.
+	// If set to -1, SlicePosition is the middle of the simulation and SliceThickness is the SmoothingKernelRadius
+	ViewMode       string  `default:"Projection" yaml:"ViewMode"`
+	SlicePosition  float64 `default:"-1" yaml:"SlicePosition"`
+	SliceThickness float64 `default:"-1" yaml:"SliceThickness"`
+
+	// Holding the left mouse button pulls particles within InteractionRadius towards the cursor, and holding the right
+	// mouse button pushes them away. The acceleration is InteractionStrength at the cursor, falling linearly to zero at
+	// InteractionRadius. In three dimensions particles are affected through the entire depth of the simulation
+	InteractionRadius   float64 `default:"100.0" yaml:"InteractionRadius"`
+	InteractionStrength float64 `default:"2.0" yaml:"InteractionStrength"`
+
 	// Spatial Hashing Config ---------------------------------------------------------------------
 
 	// Number of bins to hash cells into.
 	// If set to -1 this is set to a number of bins equal to
 	// the number of particles
 	SpatialHashingBins int `default:"-1" yaml:"SpatialHashingBins"`
+
+	// The keys given in the YAML config, to tell options that were not given from those given as their default value
+	specifiedKeys map[string]bool
 }
 
 // Finalize the config by performing any last operations.
 //
 // e.g. if SpatialHashingBins=-1, replace this with the correct number of bins
 func (simulationConfig *SimulationConfig) finalizeConfig() {
+	simulationConfig.finalizePhases()
+
+	// Emitters may add particles up to MaxParticles, so there must be enough bins for that many particles
 	if simulationConfig.SpatialHashingBins == -1 {
 		simulationConfig.SpatialHashingBins = 10 * simulationConfig.NumParticles
+		if len(simulationConfig.Emitters) > 0 {
+			simulationConfig.SpatialHashingBins = 10 * max(simulationConfig.NumParticles, simulationConfig.MaxParticles, 1)
+		}
+	}
+
+	if simulationConfig.SlicePosition == -1 {
+		simulationConfig.SlicePosition = float64(simulationConfig.SimulationDepth) / 2
+	}
+	if simulationConfig.SliceThickness == -1 {
+		simulationConfig.SliceThickness = simulationConfig.SmoothingKernelRadius
 	}
 
 	if simulationConfig.RandomSeed == 0 {
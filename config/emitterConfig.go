@@ -0,0 +1,29 @@
+package config
+
+// A nozzle that adds particles to the simulation, such as a tap or fountain.
+//
+// Particles leave the nozzle spread evenly over its width, all moving at Speed in the given Direction.
+type EmitterConfig struct {
+	// The position of the center of the nozzle. PositionZ is only used in three dimensions
+	PositionX float64 `yaml:"PositionX"`
+	PositionY float64 `yaml:"PositionY"`
+	PositionZ float64 `yaml:"PositionZ"`
+
+	// The width of the nozzle, perpendicular to the direction particles leave in, within the x-y plane
+	Width float64 `yaml:"Width"`
+
+	// The direction (in radians) particles leave the nozzle in, within the x-y plane, where 0 is the positive x direction.
+	// Remember - y axis starts with 0 at the top and increases *downwards*, so π/2 points down
+	Direction float64 `yaml:"Direction"`
+	Speed     float64 `yaml:"Speed"`
+
+	// The number of particles added per unit of simulated time
+	Rate float64 `yaml:"Rate"`
+
+	// The simulated time the emitter is active between. If EndTime is zero, the emitter never stops
+	StartTime float64 `yaml:"StartTime"`
+	EndTime   float64 `yaml:"EndTime"`
+
+	// The name of the phase of the added particles. If empty, the first phase is used
+	Phase string `yaml:"Phase"`
+}
@@ -0,0 +1,43 @@
+package config
+
+// An external body force acting on the particles, such as a magnet, a fan, a plughole, or gravity in another direction.
+//
+// Force fields are given as accelerations, so act on every particle equally regardless of mass or density.
+// Each field may be switched on and off, and have its strength modulated over simulated time.
+type ForceFieldConfig struct {
+	// One of
+	//   - "Gravity", a uniform acceleration (VectorX, VectorY, VectorZ) everywhere, which also acts on rigid bodies
+	//     and is scaled by the Boussinesq buoyancy of each particle
+	//   - "Radial", an acceleration of Strength towards (CenterX, CenterY, CenterZ), or away from it if Strength is negative
+	//   - "Vortex", an acceleration of Strength around (CenterX, CenterY, CenterZ), counterclockwise around the z axis
+	//     as seen on screen, or clockwise if Strength is negative
+	//   - "Wind", which pulls the velocity of each particle towards the wind velocity (VectorX, VectorY, VectorZ),
+	//     removing the fraction Strength of the difference per unit of simulated time
+	//   - "Drag", which slows particles down, removing the fraction Strength of their velocity per unit of simulated time
+	Type string `yaml:"Type"`
+
+	VectorX  float64 `yaml:"VectorX"`
+	VectorY  float64 `yaml:"VectorY"`
+	VectorZ  float64 `yaml:"VectorZ"`
+	Strength float64 `yaml:"Strength"`
+
+	// The center of a radial or vortex field. CenterZ is only used in three dimensions, and a vortex in three
+	// dimensions turns about the line through the center parallel to the z axis. If Radius is positive the field
+	// is strongest at the center and falls linearly to zero at Radius, otherwise the field has the same strength everywhere
+	CenterX float64 `yaml:"CenterX"`
+	CenterY float64 `yaml:"CenterY"`
+	CenterZ float64 `yaml:"CenterZ"`
+	Radius  float64 `yaml:"Radius"`
+
+	// The region a wind or drag field acts in, through the entire depth of the simulation. If empty, the field acts everywhere
+	Region RegionConfig `yaml:"Region"`
+
+	// The simulated time the field is active between. If EndTime is zero, the field never stops.
+	// If Period is positive the strength of the field is also scaled by 1 + Modulation sin(2π t / Period + PhaseOffset),
+	// so a Modulation of one varies the field between zero and double strength, and larger modulations reverse it
+	StartTime   float64 `yaml:"StartTime"`
+	EndTime     float64 `yaml:"EndTime"`
+	Period      float64 `yaml:"Period"`
+	Modulation  float64 `yaml:"Modulation"`
+	PhaseOffset float64 `yaml:"PhaseOffset"`
+}
@@ -0,0 +1,17 @@
+package config
+
+// A heated or cooled wall or region, such as a hot plate under a pan of water.
+//
+// The temperature of each particle inside the source moves towards the Temperature of the source,
+// removing the fraction Rate of the difference per unit of simulated time.
+type HeatSourceConfig struct {
+	// The edge of the simulation to heat, one of "Left", "Right", "Top", or "Bottom", in which case particles
+	// within Thickness of that edge are heated. If Thickness is zero, the SmoothingKernelRadius is used.
+	// If Wall is empty, particles inside Region are heated instead
+	Wall      string       `yaml:"Wall"`
+	Thickness float64      `yaml:"Thickness"`
+	Region    RegionConfig `yaml:"Region"`
+
+	Temperature float64 `yaml:"Temperature"`
+	Rate        float64 `yaml:"Rate"`
+}
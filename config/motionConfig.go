@@ -0,0 +1,36 @@
+package config
+
+// A prescribed trajectory for an obstacle, such as a paddle, piston, stirrer, or moving lid,
+// or for the direction of gravity, in which case only the angle is used.
+//
+// The trajectory advances with simulated time, starting from the position and angle of the obstacle (or gravity).
+type MotionConfig struct {
+	// One of "Static", "Oscillation", "Rotation", or "Keyframes". If empty, the obstacle is static
+	Type string `yaml:"Type"`
+
+	// An oscillating obstacle is moved from its position by (AmplitudeX, AmplitudeY) sin(2π t / Period + PhaseOffset),
+	// and turned from its angle by AngleAmplitude sin(2π t / Period + PhaseOffset)
+	AmplitudeX     float64 `yaml:"AmplitudeX"`
+	AmplitudeY     float64 `yaml:"AmplitudeY"`
+	AngleAmplitude float64 `yaml:"AngleAmplitude"`
+	Period         float64 `yaml:"Period"`
+	PhaseOffset    float64 `yaml:"PhaseOffset"`
+
+	// A rotating obstacle turns about its centroid at AngularVelocity radians per unit of simulated time
+	AngularVelocity float64 `yaml:"AngularVelocity"`
+
+	// A keyframed obstacle is moved between the keyframes, which must be in order of time.
+	// The position and angle are linearly interpolated between keyframes, and held before the first and after the last.
+	// If Loop is set the keyframes are instead repeated, starting again from the first keyframe after the last,
+	// so the last keyframe should usually match the first
+	Keyframes []KeyframeConfig `yaml:"Keyframes"`
+	Loop      bool             `yaml:"Loop"`
+}
+
+// The position of the centroid and the orientation (in radians) of an obstacle at a point in simulated time
+type KeyframeConfig struct {
+	Time      float64 `yaml:"Time"`
+	PositionX float64 `yaml:"PositionX"`
+	PositionY float64 `yaml:"PositionY"`
+	Angle     float64 `yaml:"Angle"`
+}
@@ -0,0 +1,16 @@
+package config
+
+// An obstacle inside the simulation, which is either static or moves along a prescribed trajectory.
+//
+// Polygon obstacles need not be convex, but must not intersect themselves.
+type ObstacleConfig struct {
+	ShapeConfig `yaml:",inline"`
+
+	// The position of the centroid, and the orientation (in radians) of the obstacle
+	PositionX float64 `yaml:"PositionX"`
+	PositionY float64 `yaml:"PositionY"`
+	Angle     float64 `yaml:"Angle"`
+
+	// How the obstacle moves. Obstacles are static by default
+	Motion MotionConfig `yaml:"Motion"`
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"log"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A single fluid phase, e.g. oil or water.
+//
+// Any property other than NumParticles, Regions, ShearModulus, and ElasticLimit that is not given is taken from the
+// corresponding global option (ParticleMass, FluidTargetDensity, ViscosityCoefficient, InitialTemperature, ThermalDiffusivity,
+// or the global option of the same name, such as ViscosityModel or YieldStress).
+// A property given as zero in the YAML config is kept as zero, while a property of a phase created in code is only taken from the global option if it is zero.
+type PhaseConfig struct {
+	Name           string  `yaml:"Name"`
+	NumParticles   int     `yaml:"NumParticles"`
+	ParticleMass   float64 `yaml:"ParticleMass"`
+	RestDensity    float64 `yaml:"RestDensity"`
+	Viscosity      float64 `yaml:"Viscosity"`
+	ViscosityModel string  `yaml:"ViscosityModel"`
+
+	// The parameters of the ViscosityModel, as described for the global options of the same name
+	FlowBehaviorIndex      float64 `yaml:"FlowBehaviorIndex"`
+	InfiniteShearViscosity float64 `yaml:"InfiniteShearViscosity"`
+	RelaxationTime         float64 `yaml:"RelaxationTime"`
+	YieldStress            float64 `yaml:"YieldStress"`
+	YieldRegularization    float64 `yaml:"YieldRegularization"`
+	MaximumViscosity       float64 `yaml:"MaximumViscosity"`
+
+	// The temperature particles of this phase start at (or are emitted at), and the rate heat diffuses through this phase
+	Temperature        float64 `yaml:"Temperature"`
+	ThermalDiffusivity float64 `yaml:"ThermalDiffusivity"`
+
+	// A phase with a positive ShearModulus is an elastoplastic solid, which resists shearing as well as compression.
+	// Once the von Mises stress of a particle exceeds the ElasticLimit the solid yields and flows plastically,
+	// so a small ElasticLimit gives a material that behaves like a fluid once disturbed enough, such as wet sand or mud.
+	// If ElasticLimit is zero the solid is perfectly elastic.
+	// The solvers other than "Explicit" never have a negative pressure, so solids using them resist being compressed but not stretched.
+	// With the "Explicit" solver the ShearModulus should be well below the bulk modulus, the PressureCoefficient multiplied by the RestDensity,
+	// as a solid that resists shearing more than compression is unstable
+	ShearModulus float64 `yaml:"ShearModulus"`
+	ElasticLimit float64 `yaml:"ElasticLimit"`
+
+	// The color of particles of this phase, as red, green, and blue, when ColorMode is "Phase"
+	Color [3]uint8 `yaml:"Color"`
+
+	// The rectangular regions the particles of this phase initially fill.
+	// Particles are spread uniformly over the total area of all regions.
+	// If no regions are given, the particles fill the entire simulation
+	Regions []RegionConfig `yaml:"Regions"`
+
+	// The keys given in the YAML config, so that properties given as zero are not replaced by the global options
+	specifiedKeys map[string]bool
+}
+
+// Unmarshal the phase, remembering which keys were given
+func (phase *PhaseConfig) UnmarshalYAML(value *yaml.Node) error {
+	// Decode into a type without this method, to avoid recursing
+	type phaseConfigFields PhaseConfig
+	if err := value.Decode((*phaseConfigFields)(phase)); err != nil {
+		return err
+	}
+	phase.specifiedKeys = mappingKeys(value)
+	return nil
+}
+
+// Check if a property of the phase was not given, i.e. it is zero and was not given in the YAML config
+func (phase *PhaseConfig) isUnspecified(key string, isZero bool) bool {
+	return isZero && !phase.specifiedKeys[key]
+}
+
+// An axis aligned rectangle in simulation coordinates.
+//
+// Remember - y axis starts with 0 at the top and increases *downwards*
+type RegionConfig struct {
+	MinX float64 `yaml:"MinX"`
+	MinY float64 `yaml:"MinY"`
+	MaxX float64 `yaml:"MaxX"`
+	MaxY float64 `yaml:"MaxY"`
+}
+
+// The area of the region, or zero if the region is empty
+func (region RegionConfig) Area() float64 {
+	return max(region.MaxX-region.MinX, 0) * max(region.MaxY-region.MinY, 0)
+}
+
+// Check if a position is inside the region, including its edges
+func (region RegionConfig) Contains(x float64, y float64) bool {
+	return x >= region.MinX && x <= region.MaxX && y >= region.MinY && y <= region.MaxY
+}
+
+// The colors given to phases that do not specify one, in order
+var defaultPhaseColors = [][3]uint8{
+	{64, 128, 255},
+	{255, 160, 32},
+	{64, 224, 96},
+	{224, 64, 192},
+}
+
+// Fill in any unspecified phase properties from the global options.
+//
+// If no phases are given, a single phase is created from the global options.
+// Otherwise, NumParticles is replaced by the total number of particles over all phases, with a warning if NumParticles was also given.
+func (simulationConfig *SimulationConfig) finalizePhases() {
+	if len(simulationConfig.Phases) == 0 {
+		simulationConfig.Phases = []PhaseConfig{{
+			Name:         "Fluid",
+			NumParticles: simulationConfig.NumParticles,
+		}}
+	}
+
+	totalParticles := 0
+	for phaseIndex := range simulationConfig.Phases {
+		phase := &simulationConfig.Phases[phaseIndex]
+		if phase.isUnspecified("ParticleMass", phase.ParticleMass == 0) {
+			phase.ParticleMass = simulationConfig.ParticleMass
+		}
+		if phase.isUnspecified("RestDensity", phase.RestDensity == 0) {
+			phase.RestDensity = simulationConfig.FluidTargetDensity
+		}
+		if phase.isUnspecified("Viscosity", phase.Viscosity == 0) {
+			phase.Viscosity = simulationConfig.ViscosityCoefficient
+		}
+		if phase.isUnspecified("ViscosityModel", phase.ViscosityModel == "") {
+			phase.ViscosityModel = simulationConfig.ViscosityModel
+		}
+		if phase.isUnspecified("FlowBehaviorIndex", phase.FlowBehaviorIndex == 0) {
+			phase.FlowBehaviorIndex = simulationConfig.FlowBehaviorIndex
+		}
+		if phase.isUnspecified("InfiniteShearViscosity", phase.InfiniteShearViscosity == 0) {
+			phase.InfiniteShearViscosity = simulationConfig.InfiniteShearViscosity
+		}
+		if phase.isUnspecified("RelaxationTime", phase.RelaxationTime == 0) {
+			phase.RelaxationTime = simulationConfig.RelaxationTime
+		}
+		if phase.isUnspecified("YieldStress", phase.YieldStress == 0) {
+			phase.YieldStress = simulationConfig.YieldStress
+		}
+		if phase.isUnspecified("YieldRegularization", phase.YieldRegularization == 0) {
+			phase.YieldRegularization = simulationConfig.YieldRegularization
+		}
+		if phase.isUnspecified("MaximumViscosity", phase.MaximumViscosity == 0) {
+			phase.MaximumViscosity = simulationConfig.MaximumViscosity
+		}
+		if phase.isUnspecified("Temperature", phase.Temperature == 0) {
+			phase.Temperature = simulationConfig.InitialTemperature
+		}
+		if phase.isUnspecified("ThermalDiffusivity", phase.ThermalDiffusivity == 0) {
+			phase.ThermalDiffusivity = simulationConfig.ThermalDiffusivity
+		}
+		if phase.isUnspecified("Color", phase.Color == [3]uint8{}) {
+			phase.Color = defaultPhaseColors[phaseIndex%len(defaultPhaseColors)]
+		}
+		if phase.ParticleMass <= 0 || phase.RestDensity <= 0 {
+			log.Panicf("phase %q must have a positive ParticleMass and RestDensity, got %v and %v", phase.Name, phase.ParticleMass, phase.RestDensity)
+		}
+		if len(phase.Regions) == 0 {
+			phase.Regions = []RegionConfig{{
+				MaxX: float64(simulationConfig.SimulationWidth),
+				MaxY: float64(simulationConfig.SimulationHeight),
+			}}
+		}
+		totalParticles += phase.NumParticles
+	}
+
+	if simulationConfig.specifiedKeys["NumParticles"] && simulationConfig.specifiedKeys["Phases"] && simulationConfig.NumParticles != totalParticles {
+		log.Printf("WARNING: NumParticles is %v, but the phases have %v particles in total, which is used instead", simulationConfig.NumParticles, totalParticles)
+	}
+	simulationConfig.NumParticles = totalParticles
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Phase properties given as zero must be kept, while properties that are not given are taken from the global options
+func TestPhasePropertiesGivenAsZeroAreKept(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContents := `
+ViscosityCoefficient: 0.5
+InitialTemperature: 10
+FlowBehaviorIndex: 0.8
+YieldStress: 2
+RandomSeed: 1
+Phases:
+  - Name: Inviscid
+    NumParticles: 10
+    Viscosity: 0
+    Temperature: 0
+    FlowBehaviorIndex: 0.3
+    YieldStress: 0
+  - Name: Default
+    NumParticles: 20
+`
+	if err := os.WriteFile(configPath, []byte(configContents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	simulationConfig, err := ReadConfigYaml(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inviscidPhase, defaultPhase := simulationConfig.Phases[0], simulationConfig.Phases[1]
+	if inviscidPhase.Viscosity != 0 || inviscidPhase.Temperature != 0 {
+		t.Errorf("phase given zero viscosity and temperature has %v and %v", inviscidPhase.Viscosity, inviscidPhase.Temperature)
+	}
+	if defaultPhase.Viscosity != 0.5 || defaultPhase.Temperature != 10 {
+		t.Errorf("phase without a viscosity or temperature has %v and %v, rather than the global options", defaultPhase.Viscosity, defaultPhase.Temperature)
+	}
+	if inviscidPhase.FlowBehaviorIndex != 0.3 || inviscidPhase.YieldStress != 0 {
+		t.Errorf("phase given a flow behavior index and yield stress has %v and %v", inviscidPhase.FlowBehaviorIndex, inviscidPhase.YieldStress)
+	}
+	if defaultPhase.FlowBehaviorIndex != 0.8 || defaultPhase.YieldStress != 2 {
+		t.Errorf("phase without viscosity model parameters has %v and %v, rather than the global options", defaultPhase.FlowBehaviorIndex, defaultPhase.YieldStress)
+	}
+	if simulationConfig.NumParticles != 30 {
+		t.Errorf("NumParticles is %v, rather than the total over all phases", simulationConfig.NumParticles)
+	}
+}
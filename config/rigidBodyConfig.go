@@ -0,0 +1,20 @@
+package config
+
+// A rigid body that is moved by the fluid.
+//
+// Polygon rigid bodies should be convex.
+type RigidBodyConfig struct {
+	ShapeConfig `yaml:",inline"`
+
+	// The mass per unit area of the body. Bodies with a density less than
+	// the rest density of the surrounding fluid will float
+	Density float64 `yaml:"Density"`
+
+	// The initial position of the centroid, orientation (in radians), and velocities of the body
+	PositionX       float64 `yaml:"PositionX"`
+	PositionY       float64 `yaml:"PositionY"`
+	Angle           float64 `yaml:"Angle"`
+	VelocityX       float64 `yaml:"VelocityX"`
+	VelocityY       float64 `yaml:"VelocityY"`
+	AngularVelocity float64 `yaml:"AngularVelocity"`
+}
@@ -0,0 +1,18 @@
+package config
+
+// The shape of a rigid body or obstacle
+type ShapeConfig struct {
+	// One of "Circle", "Box", or "Polygon"
+	Shape string `yaml:"Shape"`
+
+	// The radius of a circle
+	Radius float64 `yaml:"Radius"`
+
+	// The width and height of a box, before rotation
+	Width  float64 `yaml:"Width"`
+	Height float64 `yaml:"Height"`
+
+	// The vertices of a polygon, in order, relative to the position of the shape.
+	// The polygon is moved so that its centroid is at the position
+	Vertices [][2]float64 `yaml:"Vertices"`
+}
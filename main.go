@@ -55,9 +55,13 @@ GameLoop:
 	for {
 		// Handle Events
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
-			switch event.(type) {
+			switch event := event.(type) {
 			case *sdl.QuitEvent:
 				break GameLoop
+			case *sdl.MouseButtonEvent, *sdl.MouseMotionEvent:
+				updateMouseInteraction()
+			case *sdl.KeyboardEvent:
+				handleKeyPress(event)
 			}
 		}
 
@@ -66,6 +70,9 @@ GameLoop:
 			particleCollection.TickParticles()
 		}
 		guiConfig.DrawParticles(particleCollection.Particles, particleCollection.GetParticleColors())
+		guiConfig.DrawObstacles(particleCollection.Obstacles)
+		guiConfig.DrawRigidBodies(particleCollection.RigidBodies)
+		guiConfig.DrawGravity(particleCollection.Gravity())
 
 		// Handle frame delay for frames per second
 		timeToNextFrame := (1 / simulationConfig.FramesPerSecond) - time.Since(lastFrameTime).Seconds()
@@ -78,3 +85,29 @@ GameLoop:
 		lastFrameTime = time.Now()
 	}
 }
+
+// Pull particles towards the cursor while the left mouse button is held, and push them away while the right button is held
+func updateMouseInteraction() {
+	mouseX, mouseY, mouseButtons := sdl.GetMouseState()
+	switch {
+	case mouseButtons&sdl.ButtonLMask() != 0:
+		particleCollection.SetInteraction(float64(mouseX), float64(mouseY), true)
+	case mouseButtons&sdl.ButtonRMask() != 0:
+		particleCollection.SetInteraction(float64(mouseX), float64(mouseY), false)
+	default:
+		particleCollection.ClearInteraction()
+	}
+}
+
+// Tilt gravity towards the left or right of the window with the arrow keys. Holding a key repeats the tilt
+func handleKeyPress(event *sdl.KeyboardEvent) {
+	if event.State != sdl.PRESSED {
+		return
+	}
+	switch event.Keysym.Sym {
+	case sdl.K_LEFT:
+		particleCollection.TiltGravity(-simulationConfig.GravityTiltStep)
+	case sdl.K_RIGHT:
+		particleCollection.TiltGravity(simulationConfig.GravityTiltStep)
+	}
+}
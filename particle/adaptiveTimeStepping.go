@@ -0,0 +1,79 @@
+package particle
+
+import (
+	"math"
+)
+
+// Determine the step size to use for the next step.
+//
+// If adaptive time stepping is disabled this is simply the configured step size. Otherwise, the step size is the
+// largest allowed by each of the stability criteria, clamped to the configured bounds:
+//
+// - CFL criterion: neither particles nor sound waves (or, in elastoplastic solids, elastic waves) may travel more than
+// a fraction of the smoothing kernel radius in one step
+//
+// - Force criterion: the displacement due to acceleration alone must also be a fraction of the smoothing kernel radius
+//
+// - Viscosity criterion: viscous diffusion must not travel further than a fraction of the smoothing kernel radius
+//
+// Accelerations are taken from the most recent acceleration calculation, i.e. the previous step.
+// Before the first step they are calculated at the current state instead.
+func (particleCollection *ParticleCollection) calculateStepSize() float64 {
+	simulationConfig := particleCollection.simulationConfig
+	if !simulationConfig.AdaptiveTimeStepping {
+		return simulationConfig.SimulationStepSize
+	}
+	if particleCollection.stepCount == 0 {
+		for _, p := range particleCollection.Particles {
+			p.resetPredictedState()
+		}
+		particleCollection.calculateAccelerations()
+	}
+
+	maxVelocity := 0.0
+	maxAcceleration := 0.0
+	for particleIndex, p := range particleCollection.Particles {
+		maxVelocity = max(maxVelocity, p.Velocity.Norm(2))
+		maxAcceleration = max(maxAcceleration, particleCollection.accelerations[particleIndex].Norm(2))
+	}
+
+	// The sound speed and kinematic viscosity μ/ρ0 are taken from whichever phase (or, for non-Newtonian phases, particle) is most restrictive
+	maxSoundSpeed := 0.0
+	maxViscosity := 0.0
+	for _, phase := range simulationConfig.Phases {
+		// Longitudinal elastic waves travel at √(c^2 + 4G / 3ρ0), faster than sound in a fluid
+		soundSpeed := particleCollection.equationOfState.SoundSpeed(phase.RestDensity)
+		maxSoundSpeed = max(maxSoundSpeed, math.Sqrt(soundSpeed*soundSpeed+4*phase.ShearModulus/(3*phase.RestDensity)))
+		maxViscosity = max(maxViscosity, phase.Viscosity/phase.RestDensity)
+	}
+	if particleCollection.nonNewtonian {
+		for particleIndex := range particleCollection.Particles {
+			maxViscosity = max(maxViscosity, particleCollection.viscosities[particleIndex]/particleCollection.particlePhase(particleIndex).RestDensity)
+		}
+	}
+
+	kernelRadius := simulationConfig.SmoothingKernelRadius
+	stepSize := simulationConfig.MaximumStepSize
+	signalVelocity := maxVelocity + maxSoundSpeed
+	if signalVelocity > 0 {
+		stepSize = min(stepSize, simulationConfig.CFLSafetyFactor*kernelRadius/signalVelocity)
+	}
+	if maxAcceleration > 0 {
+		stepSize = min(stepSize, simulationConfig.ForceSafetyFactor*math.Sqrt(kernelRadius/maxAcceleration))
+	}
+	if maxViscosity > 0 {
+		stepSize = min(stepSize, simulationConfig.ViscositySafetyFactor*kernelRadius*kernelRadius/maxViscosity)
+	}
+
+	return max(stepSize, simulationConfig.MinimumStepSize)
+}
+
+// Get the step size used by the most recent call to TickParticles
+func (particleCollection *ParticleCollection) CurrentStepSize() float64 {
+	return particleCollection.currentStepSize
+}
+
+// Get the total simulated time, the sum of all step sizes taken so far
+func (particleCollection *ParticleCollection) SimulatedTime() float64 {
+	return particleCollection.simulatedTime
+}
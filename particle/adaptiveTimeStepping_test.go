@@ -0,0 +1,66 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// The first step size must be the largest allowed by each stability criterion, with a single particle set up so that each criterion
+// in turn is the most restrictive. The accelerations are only known before the first step if they are calculated for it
+func TestAdaptiveStepSizeRespectsEachBound(t *testing.T) {
+	testCases := []struct {
+		name             string
+		velocity         float64
+		gravity          float64
+		viscosity        float64
+		expectedStepSize func(simulationConfig *config.SimulationConfig) float64
+	}{
+		{
+			name:     "CFL",
+			velocity: 10,
+			expectedStepSize: func(simulationConfig *config.SimulationConfig) float64 {
+				soundSpeed := math.Sqrt(simulationConfig.PressureCoefficient)
+				return simulationConfig.CFLSafetyFactor * simulationConfig.SmoothingKernelRadius / (10 + soundSpeed)
+			},
+		},
+		{
+			name:    "Force",
+			gravity: 100,
+			expectedStepSize: func(simulationConfig *config.SimulationConfig) float64 {
+				return simulationConfig.ForceSafetyFactor * math.Sqrt(simulationConfig.SmoothingKernelRadius/100)
+			},
+		},
+		{
+			name:      "Viscosity",
+			viscosity: 100,
+			expectedStepSize: func(simulationConfig *config.SimulationConfig) float64 {
+				kinematicViscosity := 100 / simulationConfig.Phases[0].RestDensity
+				return simulationConfig.ViscositySafetyFactor * math.Pow(simulationConfig.SmoothingKernelRadius, 2) / kinematicViscosity
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			simulationConfig := config.CreateDefaultConfig()
+			simulationConfig.AdaptiveTimeStepping = true
+			simulationConfig.GravityModel = "Acceleration"
+			simulationConfig.GravityStrength = testCase.gravity
+			simulationConfig.NumParticles = 0
+			simulationConfig.Phases[0].NumParticles = 0
+			simulationConfig.Phases[0].Viscosity = testCase.viscosity
+			particleCollection := CreateParticleCollection(simulationConfig)
+			particleCollection.addParticle(particleCollection.newParticle([]float64{500, 250}, 0))
+			particleCollection.Particles[0].Velocity.SetVec(xDIR, testCase.velocity)
+
+			expectedStepSize := testCase.expectedStepSize(simulationConfig)
+			if expectedStepSize <= simulationConfig.MinimumStepSize || expectedStepSize >= simulationConfig.MaximumStepSize {
+				t.Fatalf("expected step size %v is not within the configured bounds, so the criterion is not tested", expectedStepSize)
+			}
+			if stepSize := particleCollection.calculateStepSize(); math.Abs(stepSize-expectedStepSize) > 1e-9*expectedStepSize {
+				t.Errorf("step size is %v, but the %v criterion allows at most %v", stepSize, testCase.name, expectedStepSize)
+			}
+		})
+	}
+}
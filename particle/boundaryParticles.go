@@ -0,0 +1,250 @@
+package particle
+
+import (
+	"log"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Boundary handling with fixed boundary particles, following Akinci et al. (2012),
+// "Versatile Rigid-Fluid Coupling for Incompressible SPH".
+//
+// Layers of boundary particles are placed behind the edges of the simulation and the outlines of the obstacles,
+// deep enough to fill the kernel support of a particle on the surface. The first layer is half a spacing behind
+// the surface, so that a particle on the surface is still pushed away from it. Each boundary particle b has a volume V_b = 1 / Σ_k W_bk, summed over the nearby boundary particles, so that
+// unevenly sampled boundaries contribute evenly. A fluid particle i near the boundary sees each boundary particle as
+// a fluid particle with mass Ψ_b = ρ_0 V_b, where ρ_0 is the rest density of the phase of particle i, so the density
+// of particles next to a wall no longer drops, and the pressure of the particle pushes it away from the wall.
+//
+// Moving obstacles and rigid bodies carry their boundary particles with them, keeping the volumes from the start of the simulation.
+// Rigid bodies always have boundary particles, whatever the BoundaryMode, and are pushed back by the fluid through them.
+// The volumes of the boundary particles of each rigid body are found from that body alone, as the body moves relative to everything else.
+
+// A shape sampled by boundary particles, which are carried along as the shape moves
+type shapeBoundary struct {
+	// The boundary particles placed behind the outline of the shape, starting from boundaryParticleStart,
+	// with their offsets from the centroid in the local coordinates of the shape
+	boundaryParticleStart  int
+	boundaryLocalPositions [][2]float64
+}
+
+// Create the boundary particles and their volumes, if the BoundaryMode or any rigid bodies require them
+func (particleCollection *ParticleCollection) createBoundaryParticles() {
+	simulationConfig := particleCollection.simulationConfig
+	switch simulationConfig.BoundaryMode {
+	case "Reflect":
+		if len(particleCollection.RigidBodies) == 0 {
+			return
+		}
+	case "BoundaryParticles":
+	default:
+		log.Panicf("unknown boundary mode %q", simulationConfig.BoundaryMode)
+	}
+
+	spacing := simulationConfig.BoundaryParticleSpacing
+	if spacing <= 0 {
+		spacing = simulationConfig.SmoothingKernelRadius / 2
+		for _, phase := range simulationConfig.Phases {
+			spacing = min(spacing, math.Sqrt(phase.ParticleMass/phase.RestDensity))
+		}
+	}
+
+	// The edges of the simulation have the fluid inside, while obstacles have the fluid outside.
+	// Edges along periodic axes are not walls, so are skipped
+	numLayers := int(math.Ceil(simulationConfig.SmoothingKernelRadius / spacing))
+	simulationWidth := float64(simulationConfig.SimulationWidth)
+	simulationHeight := float64(simulationConfig.SimulationHeight)
+	simulationCorners := []*mat.VecDense{
+		mat.NewVecDense(2, []float64{0, 0}),
+		mat.NewVecDense(2, []float64{simulationWidth, 0}),
+		mat.NewVecDense(2, []float64{simulationWidth, simulationHeight}),
+		mat.NewVecDense(2, []float64{0, simulationHeight}),
+	}
+	if simulationConfig.BoundaryMode == "BoundaryParticles" {
+		for cornerIndex, startCorner := range simulationCorners {
+			// Edges from an even corner run along the x axis, and so bound the y axis
+			if (cornerIndex%2 == 0 && simulationConfig.PeriodicY) || (cornerIndex%2 == 1 && simulationConfig.PeriodicX) {
+				continue
+			}
+			particleCollection.sampleBoundaryEdge(startCorner, simulationCorners[(cornerIndex+1)%len(simulationCorners)], spacing, numLayers, 1)
+		}
+		for _, obstacle := range particleCollection.Obstacles {
+			particleCollection.sampleShapeBoundary(&obstacle.placedShape, &obstacle.shapeBoundary, spacing, numLayers)
+		}
+	}
+	particleCollection.rigidBodyBoundaryStart = len(particleCollection.boundaryParticles)
+	for _, body := range particleCollection.RigidBodies {
+		particleCollection.sampleShapeBoundary(&body.placedShape, &body.shapeBoundary, spacing, numLayers)
+	}
+
+	numBoundaryParticles := len(particleCollection.boundaryParticles)
+	particleCollection.boundarySpatialHashing = createSpatialHashingStructure(
+		2*simulationConfig.SmoothingKernelRadius,
+		max(10*numBoundaryParticles, 1),
+		numBoundaryParticles,
+		particleCollection.simulationSizes(),
+		particleCollection.periodicAxes(),
+	)
+	particleCollection.boundarySpatialHashing.updateSpatialHashing(particleCollection.boundaryParticles)
+
+	// The boundary particles of each rigid body only see the other boundary particles of that body
+	particleCollection.boundaryVolumes = make([]float64, numBoundaryParticles)
+	particleCollection.calculateBoundaryVolumes(0, particleCollection.rigidBodyBoundaryStart)
+	for _, body := range particleCollection.RigidBodies {
+		particleCollection.calculateBoundaryVolumes(body.boundaryParticleStart, body.boundaryParticleStart+len(body.boundaryLocalPositions))
+	}
+}
+
+// Calculate the volume V_b = 1 / Σ_k W_bk of each boundary particle with an index in [start, end),
+// summed over the nearby boundary particles in the same range
+func (particleCollection *ParticleCollection) calculateBoundaryVolumes(start int, end int) {
+	displacementVec := mat.NewVecDense(2, nil)
+	for boundaryIndex := start; boundaryIndex < end; boundaryIndex += 1 {
+		boundaryParticle := particleCollection.boundaryParticles[boundaryIndex]
+		kernelSum := 0.0
+		for _, neighborIndex := range particleCollection.boundarySpatialHashing.getAllNeighboringParticleIndices(boundaryParticle) {
+			if neighborIndex < start || neighborIndex >= end {
+				continue
+			}
+			particleCollection.calculateDisplacement(displacementVec, boundaryParticle.Position, particleCollection.boundaryParticles[neighborIndex].Position)
+			kernelSum += particleCollection.densityKernel.Value(displacementVec.Norm(2))
+		}
+		particleCollection.boundaryVolumes[boundaryIndex] = 1 / kernelSum
+	}
+}
+
+// Place layers of boundary particles inside the outline of a shape, as for an obstacle,
+// remembering where each particle is on the shape so that it can be moved with the shape.
+//
+// The inner layers of a shape thinner than the layers pass out of the other side, so any particle outside the shape is dropped
+func (particleCollection *ParticleCollection) sampleShapeBoundary(placed *placedShape, boundary *shapeBoundary, spacing float64, numLayers int) {
+	boundary.boundaryParticleStart = len(particleCollection.boundaryParticles)
+	particleCollection.sampleBoundaryOutline(placed.Outline(), spacing, numLayers, -1)
+	keptParticles := boundary.boundaryParticleStart
+	for _, boundaryParticle := range particleCollection.boundaryParticles[boundary.boundaryParticleStart:] {
+		if distance, _, _ := placed.signedDistance(boundaryParticle.Position.AtVec(xDIR), boundaryParticle.Position.AtVec(yDIR)); distance < 0 {
+			particleCollection.boundaryParticles[keptParticles] = boundaryParticle
+			keptParticles += 1
+		}
+	}
+	particleCollection.boundaryParticles = particleCollection.boundaryParticles[:keptParticles]
+
+	for _, boundaryParticle := range particleCollection.boundaryParticles[boundary.boundaryParticleStart:] {
+		localX, localY := placed.unrotate(
+			boundaryParticle.Position.AtVec(xDIR)-placed.Position.AtVec(xDIR),
+			boundaryParticle.Position.AtVec(yDIR)-placed.Position.AtVec(yDIR),
+		)
+		boundary.boundaryLocalPositions = append(boundary.boundaryLocalPositions, [2]float64{localX, localY})
+	}
+}
+
+// Move the boundary particles of a shape to the current pose of the shape, with the velocity of the surface of the shape.
+//
+// The boundary spatial hashing must be updated afterwards.
+func (particleCollection *ParticleCollection) moveShapeBoundary(placed *placedShape, boundary *shapeBoundary) {
+	for localIndex, localPosition := range boundary.boundaryLocalPositions {
+		boundaryParticle := particleCollection.boundaryParticles[boundary.boundaryParticleStart+localIndex]
+		offsetX, offsetY := placed.rotate(localPosition[0], localPosition[1])
+		boundaryParticle.Position.SetVec(xDIR, placed.Position.AtVec(xDIR)+offsetX)
+		boundaryParticle.Position.SetVec(yDIR, placed.Position.AtVec(yDIR)+offsetY)
+		particleCollection.wrapPeriodicPosition(boundaryParticle.Position)
+		boundaryParticle.PredictedPosition.CopyVec(boundaryParticle.Position)
+		velocityX, velocityY := placed.velocityAt(offsetX, offsetY)
+		boundaryParticle.Velocity.SetVec(xDIR, velocityX)
+		boundaryParticle.Velocity.SetVec(yDIR, velocityY)
+	}
+}
+
+// Place layers of boundary particles behind each edge of a closed outline, no further apart than the given spacing.
+//
+// The outline must have a positive signed area, so that (b_y - a_y, a_x - b_x) is the outward normal of the edge
+// from a to b. The layers are placed along the outward normal if normalSign is 1, or against it if normalSign is -1.
+func (particleCollection *ParticleCollection) sampleBoundaryOutline(outline []*mat.VecDense, spacing float64, numLayers int, normalSign float64) {
+	for pointIndex, startPoint := range outline {
+		particleCollection.sampleBoundaryEdge(startPoint, outline[(pointIndex+1)%len(outline)], spacing, numLayers, normalSign)
+	}
+}
+
+// Place layers of boundary particles behind the edge from startPoint to endPoint, in the same way as sampleBoundaryOutline
+func (particleCollection *ParticleCollection) sampleBoundaryEdge(startPoint *mat.VecDense, endPoint *mat.VecDense, spacing float64, numLayers int, normalSign float64) {
+	edgeVec := mat.NewVecDense(2, nil)
+	normalVec := mat.NewVecDense(2, nil)
+	edgeVec.SubVec(endPoint, startPoint)
+	edgeLength := edgeVec.Norm(2)
+	if edgeLength == 0 {
+		return
+	}
+	normalVec.SetVec(xDIR, normalSign*edgeVec.AtVec(yDIR)/edgeLength)
+	normalVec.SetVec(yDIR, -normalSign*edgeVec.AtVec(xDIR)/edgeLength)
+
+	numSamples := int(math.Ceil(edgeLength / spacing))
+	for layerIndex := 0; layerIndex < numLayers; layerIndex += 1 {
+		for sampleIndex := 0; sampleIndex < numSamples; sampleIndex += 1 {
+			position := mat.NewVecDense(2, nil)
+			position.AddScaledVec(startPoint, float64(sampleIndex)/float64(numSamples), edgeVec)
+			position.AddScaledVec(position, (float64(layerIndex)+0.5)*spacing, normalVec)
+			particleCollection.boundaryParticles = append(particleCollection.boundaryParticles, &Particle{
+				PredictedPosition: mat.VecDenseCopyOf(position),
+				PredictedVelocity: mat.NewVecDense(2, nil),
+				Position:          position,
+				Velocity:          mat.NewVecDense(2, nil),
+			})
+		}
+	}
+}
+
+// Get the indices of the boundary particles near the predicted position of a particle.
+//
+// If there are no boundary particles, this is always empty.
+func (particleCollection *ParticleCollection) getNeighboringBoundaryIndices(targetParticle *Particle) []int {
+	if particleCollection.boundarySpatialHashing == nil {
+		return nil
+	}
+	return particleCollection.boundarySpatialHashing.getAllNeighboringParticleIndices(targetParticle)
+}
+
+// Get the mass Ψ_b = ρ_0 V_b of a boundary particle as seen by the given particle
+func (particleCollection *ParticleCollection) boundaryMass(particleIndex int, boundaryIndex int) float64 {
+	return particleCollection.particlePhase(particleIndex).RestDensity * particleCollection.boundaryVolumes[boundaryIndex]
+}
+
+// Calculate the gradient of the pressure kernel between a particle at its predicted position and a boundary particle,
+// ∇W_ib, storing the result in gradientVec.
+//
+// Returns false if the particles are coincident, in which case the gradient is undefined.
+func (particleCollection *ParticleCollection) calculateBoundaryKernelGradient(gradientVec *mat.VecDense, particleIndex int, boundaryIndex int) bool {
+	particleCollection.calculateDisplacement(gradientVec, particleCollection.Particles[particleIndex].PredictedPosition, particleCollection.boundaryParticles[boundaryIndex].Position)
+	displacementMagnitude := gradientVec.Norm(2)
+	if displacementMagnitude == 0 {
+		return false
+	}
+
+	gradientVec.ScaleVec(particleCollection.pressureKernel.Gradient(displacementMagnitude)/displacementMagnitude, gradientVec)
+	return true
+}
+
+// Add the pressure acceleration due to the boundary on a particle, -Σ_b Ψ_b (p_i / ρ_i^2) ∇W_ib,
+// given the pressure term p_i / ρ_i^2 of that particle
+func (particleCollection *ParticleCollection) addBoundaryPressureAcceleration(acceleration *mat.VecDense, particleIndex int, pressureTerm float64) {
+	gradientVec := mat.NewVecDense(2, nil)
+	for _, boundaryIndex := range particleCollection.getNeighboringBoundaryIndices(particleCollection.Particles[particleIndex]) {
+		if !particleCollection.calculateBoundaryKernelGradient(gradientVec, particleIndex, boundaryIndex) {
+			continue
+		}
+		acceleration.AddScaledVec(acceleration, -particleCollection.boundaryMass(particleIndex, boundaryIndex)*pressureTerm, gradientVec)
+	}
+}
+
+// Calculate the sum of the boundary contributions to the density gradient of a particle, Σ_b Ψ_b ∇W_ib,
+// storing the result in gradientSum
+func (particleCollection *ParticleCollection) calculateBoundaryGradientSum(gradientSum *mat.VecDense, particleIndex int) {
+	gradientVec := mat.NewVecDense(2, nil)
+	gradientSum.Zero()
+	for _, boundaryIndex := range particleCollection.getNeighboringBoundaryIndices(particleCollection.Particles[particleIndex]) {
+		if !particleCollection.calculateBoundaryKernelGradient(gradientVec, particleIndex, boundaryIndex) {
+			continue
+		}
+		gradientSum.AddScaledVec(gradientSum, particleCollection.boundaryMass(particleIndex, boundaryIndex), gradientVec)
+	}
+}
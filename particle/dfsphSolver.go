@@ -0,0 +1,226 @@
+package particle
+
+import (
+	"gonum.org/v1/gonum/mat"
+)
+
+// Divergence-free SPH, following Bender and Koschier (2015).
+//
+// Two pressure solvers are used each step. The divergence solver corrects the velocities so that the density
+// is not changing, and the density solver corrects the velocities (after non-pressure accelerations are applied)
+// so that the density after the step will be at rest density. Both solvers share the per particle factor α,
+// which depends only on the neighborhood of each particle and so is calculated once per step.
+type dfsphSolver struct {
+	// The factor α of each particle
+	factors []float64
+
+	// The stiffness κ of each particle in the current iteration
+	stiffnesses []float64
+
+	// The (non-negative) density error or change in density over a step of each particle in the current iteration,
+	// relative to its rest density
+	densityErrors []float64
+}
+
+func (solver *dfsphSolver) Step(particleCollection *ParticleCollection, stepSize float64) {
+	simulationConfig := particleCollection.simulationConfig
+	for len(solver.factors) < len(particleCollection.Particles) {
+		solver.factors = append(solver.factors, 0)
+		solver.stiffnesses = append(solver.stiffnesses, 0)
+		solver.densityErrors = append(solver.densityErrors, 0)
+	}
+	particleCollection.solverStatistics = SolverStatistics{}
+	clear(particleCollection.boundaryPressureTerms)
+
+	for _, p := range particleCollection.Particles {
+		p.resetPredictedState()
+	}
+	particleCollection.updateNeighborhoods()
+	particleCollection.runParticleWorkers(solver.calculateFactorWorker(particleCollection))
+
+	if simulationConfig.DivergenceSolverEnabled {
+		solver.solveDivergence(particleCollection, stepSize)
+		for _, p := range particleCollection.Particles {
+			p.resetPredictedState()
+		}
+	}
+
+	// The non-pressure accelerations are applied to the (divergence free) velocities before the density solve
+	particleCollection.runParticleWorkers(particleCollection.calculateNonPressureAccelerationWorker)
+	for particleIndex, p := range particleCollection.Particles {
+		p.Velocity.AddScaledVec(p.Velocity, stepSize, particleCollection.accelerations[particleIndex])
+	}
+
+	solver.solveDensity(particleCollection, stepSize)
+
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Position.AddScaledVec(targetParticle.Position, stepSize, targetParticle.Velocity)
+			particleCollection.handleSimulationEdges(particleIndex)
+		}
+	})
+}
+
+// Correct the velocities until the average predicted density error after the step is below the tolerance
+func (solver *dfsphSolver) solveDensity(particleCollection *ParticleCollection, stepSize float64) {
+	simulationConfig := particleCollection.simulationConfig
+
+	iteration := 0
+	averageDensityError := 0.0
+	for iteration < simulationConfig.PressureSolverMaxIterations {
+		particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+			gradientVec := particleCollection.newVector()
+			velocityDifferential := particleCollection.newVector()
+			for particleIndex := range particleIndexChannel {
+				densityRateOfChange := solver.calculateDensityRateOfChange(particleCollection, particleIndex, gradientVec, velocityDifferential)
+				predictedDensity := particleCollection.densities[particleIndex] + stepSize*densityRateOfChange
+				restDensity := particleCollection.particlePhase(particleIndex).RestDensity
+				densityError := max(predictedDensity-restDensity, 0)
+				solver.densityErrors[particleIndex] = densityError / restDensity
+				solver.stiffnesses[particleIndex] = densityError * solver.factors[particleIndex] / (stepSize * stepSize)
+			}
+		})
+		particleCollection.runParticleWorkers(solver.applyStiffnessWorker(particleCollection, stepSize))
+		iteration += 1
+
+		averageDensityError = solver.averageDensityError(particleCollection)
+		if iteration >= simulationConfig.PressureSolverMinIterations && averageDensityError <= simulationConfig.PressureSolverTolerance {
+			break
+		}
+	}
+
+	particleCollection.solverStatistics.DensityIterations = iteration
+	particleCollection.solverStatistics.DensityResidual = averageDensityError
+}
+
+// Correct the velocities until the average density change over a step is below the tolerance
+func (solver *dfsphSolver) solveDivergence(particleCollection *ParticleCollection, stepSize float64) {
+	simulationConfig := particleCollection.simulationConfig
+
+	iteration := 0
+	averageDivergenceError := 0.0
+	for iteration < simulationConfig.DivergenceSolverMaxIterations {
+		particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+			gradientVec := particleCollection.newVector()
+			velocityDifferential := particleCollection.newVector()
+			for particleIndex := range particleIndexChannel {
+				densityRateOfChange := solver.calculateDensityRateOfChange(particleCollection, particleIndex, gradientVec, velocityDifferential)
+				densityRateOfChange = max(densityRateOfChange, 0)
+				solver.densityErrors[particleIndex] = densityRateOfChange * stepSize / particleCollection.particlePhase(particleIndex).RestDensity
+				solver.stiffnesses[particleIndex] = densityRateOfChange * solver.factors[particleIndex] / stepSize
+			}
+		})
+		particleCollection.runParticleWorkers(solver.applyStiffnessWorker(particleCollection, stepSize))
+		iteration += 1
+
+		averageDivergenceError = solver.averageDensityError(particleCollection)
+		if averageDivergenceError <= simulationConfig.DivergenceSolverTolerance {
+			break
+		}
+	}
+
+	particleCollection.solverStatistics.DivergenceIterations = iteration
+	particleCollection.solverStatistics.DivergenceResidual = averageDivergenceError
+}
+
+// The average of the density errors of the current iteration, summed in particle order
+func (solver *dfsphSolver) averageDensityError(particleCollection *ParticleCollection) float64 {
+	if len(particleCollection.Particles) == 0 {
+		return 0
+	}
+
+	totalDensityError := 0.0
+	for particleIndex := range particleCollection.Particles {
+		totalDensityError += solver.densityErrors[particleIndex]
+	}
+	return totalDensityError / float64(len(particleCollection.Particles))
+}
+
+// Calculate the rate of change of density of a particle from the current velocities,
+// m_i Σ (v_i - v_j) · ∇W_ij + Σ_b Ψ_b (v_i - v_b) · ∇W_ib
+func (solver *dfsphSolver) calculateDensityRateOfChange(particleCollection *ParticleCollection, particleIndex int, gradientVec *mat.VecDense, velocityDifferential *mat.VecDense) float64 {
+	targetParticle := particleCollection.Particles[particleIndex]
+	particleMass := particleCollection.particlePhase(particleIndex).ParticleMass
+
+	densityRateOfChange := 0.0
+	neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+	for _, neighborIndex := range neighboringParticleIndices {
+		if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+			continue
+		}
+		velocityDifferential.SubVec(targetParticle.Velocity, particleCollection.Particles[neighborIndex].Velocity)
+		densityRateOfChange += particleMass * mat.Dot(velocityDifferential, gradientVec)
+	}
+
+	// Boundary particles of moving obstacles move with the obstacle
+	for _, boundaryIndex := range particleCollection.getNeighboringBoundaryIndices(targetParticle) {
+		if !particleCollection.calculateBoundaryKernelGradient(gradientVec, particleIndex, boundaryIndex) {
+			continue
+		}
+		velocityDifferential.SubVec(targetParticle.Velocity, particleCollection.boundaryParticles[boundaryIndex].Velocity)
+		densityRateOfChange += particleCollection.boundaryMass(particleIndex, boundaryIndex) * mat.Dot(velocityDifferential, gradientVec)
+	}
+	return densityRateOfChange
+}
+
+// Create a worker to calculate the factor α of each particle,
+// ρ_i / (|Σ m_i ∇W_ij + Σ_b Ψ_b ∇W_ib|^2 + Σ |m_i ∇W_ij|^2)
+func (solver *dfsphSolver) calculateFactorWorker(particleCollection *ParticleCollection) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		gradientVec := particleCollection.newVector()
+		gradientSum := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			particleMass := particleCollection.particlePhase(particleIndex).ParticleMass
+			gradientSum.Zero()
+			gradientDotSum := 0.0
+
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+					continue
+				}
+				gradientVec.ScaleVec(particleMass, gradientVec)
+				gradientSum.AddVec(gradientSum, gradientVec)
+				gradientDotSum += mat.Dot(gradientVec, gradientVec)
+			}
+			particleCollection.calculateBoundaryGradientSum(gradientVec, particleIndex)
+			gradientSum.AddVec(gradientSum, gradientVec)
+
+			// Particles with (almost) no neighbors cannot be corrected
+			denominator := mat.Dot(gradientSum, gradientSum) + gradientDotSum
+			if denominator < 1e-12 {
+				solver.factors[particleIndex] = 0
+			} else {
+				solver.factors[particleIndex] = particleCollection.densities[particleIndex] / denominator
+			}
+		}
+	}
+}
+
+// Create a worker to correct the velocity of each particle using the current stiffnesses,
+// v_i -= Δt Σ m_j (κ_i / ρ_i + κ_j / ρ_j) ∇W_ij + Δt Σ_b Ψ_b (κ_i / ρ_i) ∇W_ib.
+//
+// The boundary terms κ_i / ρ_i of every iteration add up to the pressure term of the particle against the boundary over the step.
+func (solver *dfsphSolver) applyStiffnessWorker(particleCollection *ParticleCollection, stepSize float64) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		gradientVec := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetStiffnessTerm := solver.stiffnesses[particleIndex] / particleCollection.densities[particleIndex]
+
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+					continue
+				}
+				neighborStiffnessTerm := solver.stiffnesses[neighborIndex] / particleCollection.densities[neighborIndex]
+				scale := -stepSize * particleCollection.particlePhase(neighborIndex).ParticleMass * (targetStiffnessTerm + neighborStiffnessTerm)
+				targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, scale, gradientVec)
+			}
+			particleCollection.boundaryPressureTerms[particleIndex] += targetStiffnessTerm
+			particleCollection.addBoundaryPressureAcceleration(targetParticle.Velocity, particleIndex, stepSize*targetStiffnessTerm)
+		}
+	}
+}
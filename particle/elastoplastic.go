@@ -0,0 +1,233 @@
+package particle
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Elastoplastic solids follow Gray, Monaghan, and Swift (2001), "SPH Elastic Dynamics", with perfect von Mises plasticity.
+// Each solid particle carries a deviatoric stress S, advanced with the Jaumann rate and returned to the yield surface
+// once the von Mises stress exceeds the elastic limit. The velocity gradient uses the Randles and Libersky (1996) correction,
+// and the artificial stress of Monaghan (2000) keeps particles under tension from clumping.
+
+// The exponent of the kernel ratio in the artificial stress
+const artificialStressExponent = 4
+
+// The largest condition number of the kernel gradient moments that is corrected.
+// Particles with only a few neighbors, such as those in a splash, have nearly singular moments,
+// and the correction would multiply their velocity gradient by an enormous amount
+const maximumGradientCorrectionCondition = 10
+
+// Advance the deviatoric stress of each particle of a solid phase over a step, and then return any stress
+// beyond the elastic limit to the yield surface.
+//
+// The stress rate uses the velocities at the end of the step, as the velocities were found using the stresses at the
+// start of the step. Using the velocities at the start of the step instead adds energy to every elastic oscillation.
+func (particleCollection *ParticleCollection) updateStresses(stepSize float64) {
+	if !particleCollection.elastoplastic {
+		return
+	}
+
+	for _, p := range particleCollection.Particles {
+		p.resetPredictedState()
+	}
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		gradientVec := particleCollection.newVector()
+		velocityDifferential := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetPhase := particleCollection.particlePhase(particleIndex)
+			if targetPhase.ShearModulus == 0 {
+				continue
+			}
+
+			// The stress rate of each particle only depends on its own stress, so the stress can be updated in place
+			stress := &particleCollection.Particles[particleIndex].deviatoricStress
+			stressRate := particleCollection.calculateStressRate(particleIndex, gradientVec, velocityDifferential)
+			for row := 0; row < particleCollection.dimensions; row += 1 {
+				for column := 0; column < particleCollection.dimensions; column += 1 {
+					stress[row][column] += stepSize * stressRate[row][column]
+				}
+			}
+			particleCollection.returnToYieldSurface(stress, targetPhase.ElasticLimit)
+		}
+	})
+}
+
+// Calculate the Jaumann rate of the deviatoric stress of a particle at the predicted state
+func (particleCollection *ParticleCollection) calculateStressRate(particleIndex int, gradientVec *mat.VecDense, velocityDifferential *mat.VecDense) [3][3]float64 {
+	dimensions := particleCollection.dimensions
+	shearModulus := particleCollection.particlePhase(particleIndex).ShearModulus
+	stress := &particleCollection.Particles[particleIndex].deviatoricStress
+
+	uncorrectedVelocityGradient := particleCollection.calculateVelocityGradient(particleIndex, gradientVec, velocityDifferential)
+	gradientCorrection := particleCollection.calculateGradientCorrection(particleIndex, gradientVec, velocityDifferential)
+	var velocityGradient, strainRate, spin [3][3]float64
+	for row := 0; row < dimensions; row += 1 {
+		for column := 0; column < dimensions; column += 1 {
+			for k := 0; k < dimensions; k += 1 {
+				velocityGradient[row][column] += uncorrectedVelocityGradient[row][k] * gradientCorrection[k][column]
+			}
+		}
+	}
+
+	strainRateTrace := 0.0
+	for row := 0; row < dimensions; row += 1 {
+		for column := 0; column < dimensions; column += 1 {
+			strainRate[row][column] = (velocityGradient[row][column] + velocityGradient[column][row]) / 2
+			spin[row][column] = (velocityGradient[row][column] - velocityGradient[column][row]) / 2
+		}
+		strainRateTrace += strainRate[row][row]
+	}
+
+	var stressRate [3][3]float64
+	for row := 0; row < dimensions; row += 1 {
+		for column := 0; column < dimensions; column += 1 {
+			deviatoricStrainRate := strainRate[row][column]
+			if row == column {
+				deviatoricStrainRate -= strainRateTrace / float64(dimensions)
+			}
+
+			rotation := 0.0
+			for k := 0; k < dimensions; k += 1 {
+				rotation += stress[row][k]*spin[column][k] + spin[row][k]*stress[k][column]
+			}
+			stressRate[row][column] = 2*shearModulus*deviatoricStrainRate + rotation
+		}
+	}
+	return stressRate
+}
+
+// Calculate the correction of the kernel gradient of a particle at the predicted state, L_i = (Σ (m_j / ρ_j) (x_j - x_i) ⊗ ∇W_ij)^-1.
+// A velocity gradient multiplied by this is exact for any linear velocity field.
+// Particles whose sum is poorly conditioned, as they have too few neighbors, are not corrected.
+func (particleCollection *ParticleCollection) calculateGradientCorrection(particleIndex int, gradientVec *mat.VecDense, displacementVec *mat.VecDense) [3][3]float64 {
+	dimensions := particleCollection.dimensions
+	targetParticle := particleCollection.Particles[particleIndex]
+	gradientMoment := mat.NewDense(dimensions, dimensions, nil)
+
+	neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+	for _, neighborIndex := range neighboringParticleIndices {
+		if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+			continue
+		}
+
+		neighborVolume := particleCollection.particlePhase(neighborIndex).ParticleMass / particleCollection.densities[neighborIndex]
+		particleCollection.calculateDisplacement(displacementVec, particleCollection.Particles[neighborIndex].PredictedPosition, targetParticle.PredictedPosition)
+		for row := 0; row < dimensions; row += 1 {
+			for column := 0; column < dimensions; column += 1 {
+				gradientMoment.Set(row, column, gradientMoment.At(row, column)+neighborVolume*displacementVec.AtVec(row)*gradientVec.AtVec(column))
+			}
+		}
+	}
+
+	var gradientCorrection [3][3]float64
+	var inverse mat.Dense
+	if mat.Cond(gradientMoment, 2) > maximumGradientCorrectionCondition || inverse.Inverse(gradientMoment) != nil {
+		for row := 0; row < dimensions; row += 1 {
+			gradientCorrection[row][row] = 1
+		}
+		return gradientCorrection
+	}
+	for row := 0; row < dimensions; row += 1 {
+		for column := 0; column < dimensions; column += 1 {
+			gradientCorrection[row][column] = inverse.At(row, column)
+		}
+	}
+	return gradientCorrection
+}
+
+// Scale a deviatoric stress back onto the von Mises yield surface if it lies outside.
+// An elastic limit of zero is a perfectly elastic solid, which never yields
+func (particleCollection *ParticleCollection) returnToYieldSurface(stress *[3][3]float64, elasticLimit float64) {
+	if elasticLimit == 0 {
+		return
+	}
+
+	stressContraction := 0.0
+	for row := 0; row < particleCollection.dimensions; row += 1 {
+		for column := 0; column < particleCollection.dimensions; column += 1 {
+			stressContraction += stress[row][column] * stress[row][column]
+		}
+	}
+	vonMisesStress := math.Sqrt(1.5 * stressContraction)
+	if vonMisesStress <= elasticLimit {
+		return
+	}
+
+	yieldScale := elasticLimit / vonMisesStress
+	for row := 0; row < particleCollection.dimensions; row += 1 {
+		for column := 0; column < particleCollection.dimensions; column += 1 {
+			stress[row][column] *= yieldScale
+		}
+	}
+}
+
+// Calculate the artificial stress of each particle from its deviatoric stress, storing the result in particleCollection.artificialStresses.
+// Particles of fluid phases have no artificial stress.
+func (particleCollection *ParticleCollection) calculateArtificialStressWorker(particleIndexChannel <-chan int) {
+	dimensions := particleCollection.dimensions
+	stressMatrix := mat.NewSymDense(dimensions, nil)
+	var eigen mat.EigenSym
+	var eigenvectors mat.Dense
+	for particleIndex := range particleIndexChannel {
+		artificialStress := &particleCollection.artificialStresses[particleIndex]
+		*artificialStress = [3][3]float64{}
+		if particleCollection.particlePhase(particleIndex).ShearModulus == 0 {
+			continue
+		}
+
+		stress := &particleCollection.Particles[particleIndex].deviatoricStress
+		for row := 0; row < dimensions; row += 1 {
+			for column := row; column < dimensions; column += 1 {
+				stressMatrix.SetSym(row, column, stress[row][column])
+			}
+		}
+		if !eigen.Factorize(stressMatrix, true) {
+			continue
+		}
+		eigen.VectorsTo(&eigenvectors)
+
+		density := particleCollection.densities[particleIndex]
+		for principalIndex, principalStress := range eigen.Values(nil) {
+			if principalStress <= 0 {
+				continue
+			}
+			principalArtificialStress := -particleCollection.simulationConfig.ArtificialStressCoefficient * principalStress / (density * density)
+			for row := 0; row < dimensions; row += 1 {
+				for column := 0; column < dimensions; column += 1 {
+					artificialStress[row][column] += principalArtificialStress * eigenvectors.At(row, principalIndex) * eigenvectors.At(column, principalIndex)
+				}
+			}
+		}
+	}
+}
+
+// Add the acceleration on the target particle due to the deviatoric and artificial stress of it and a single neighbor.
+//
+// direction is the unit vector from the neighbor to the target particle, and distance is the distance between them.
+func (particleCollection *ParticleCollection) addStressAcceleration(acceleration *mat.VecDense, particleIndex int, neighborIndex int, direction *mat.VecDense, distance float64) {
+	targetStress := &particleCollection.Particles[particleIndex].deviatoricStress
+	neighborStress := &particleCollection.Particles[neighborIndex].deviatoricStress
+	targetDensitySquared := particleCollection.densities[particleIndex] * particleCollection.densities[particleIndex]
+	neighborDensitySquared := particleCollection.densities[neighborIndex] * particleCollection.densities[neighborIndex]
+
+	targetArtificialStress := &particleCollection.artificialStresses[particleIndex]
+	neighborArtificialStress := &particleCollection.artificialStresses[neighborIndex]
+	artificialStressScale := 0.0
+	if artificialStressReference := particleCollection.artificialStressReferences[particleCollection.Particles[particleIndex].Phase]; artificialStressReference > 0 {
+		artificialStressScale = math.Pow(particleCollection.densityKernel.Value(distance)/artificialStressReference, artificialStressExponent)
+	}
+
+	// ∇W_ij is the derivative of the kernel along the direction from the neighbor to the target particle
+	gradientScale := particleCollection.particlePhase(neighborIndex).ParticleMass * particleCollection.pressureKernel.Gradient(distance)
+	for row := 0; row < particleCollection.dimensions; row += 1 {
+		stressDotDirection := 0.0
+		for column := 0; column < particleCollection.dimensions; column += 1 {
+			stressTerm := targetStress[row][column]/targetDensitySquared + neighborStress[row][column]/neighborDensitySquared
+			stressTerm += artificialStressScale * (targetArtificialStress[row][column] + neighborArtificialStress[row][column])
+			stressDotDirection += stressTerm * direction.AtVec(column)
+		}
+		acceleration.SetVec(row, acceleration.AtVec(row)+gradientScale*stressDotDirection)
+	}
+}
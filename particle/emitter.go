@@ -0,0 +1,141 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+	"slices"
+)
+
+// A nozzle that adds particles to the simulation at a steady rate
+type emitter struct {
+	config     config.EmitterConfig
+	phaseIndex int
+
+	// The unit vectors along the direction particles leave in, and across the nozzle
+	directionX, directionY float64
+	acrossX, acrossY       float64
+
+	// The fraction of a particle that is owed from previous steps, so that low rates still add particles
+	pendingParticles float64
+}
+
+func newEmitter(emitterConfig config.EmitterConfig, phases []config.PhaseConfig) *emitter {
+	phaseIndex := 0
+	if emitterConfig.Phase != "" {
+		phaseIndex = slices.IndexFunc(phases, func(phase config.PhaseConfig) bool { return phase.Name == emitterConfig.Phase })
+		if phaseIndex == -1 {
+			log.Panicf("unknown emitter phase %q", emitterConfig.Phase)
+		}
+	}
+
+	directionY, directionX := math.Sincos(emitterConfig.Direction)
+	return &emitter{
+		config:     emitterConfig,
+		phaseIndex: phaseIndex,
+		directionX: directionX,
+		directionY: directionY,
+		acrossX:    -directionY,
+		acrossY:    directionX,
+	}
+}
+
+// Add particles from every active emitter for a step starting at the current simulated time, up to MaxParticles.
+//
+// Particles added in the same step are spread along the direction of the emitter by the distance they
+// would have moved over the step, so they do not start on top of one another.
+func (particleCollection *ParticleCollection) emitParticles(stepSize float64) {
+	for _, nozzle := range particleCollection.emitters {
+		simulatedTime := particleCollection.simulatedTime
+		if simulatedTime < nozzle.config.StartTime || (nozzle.config.EndTime != 0 && simulatedTime >= nozzle.config.EndTime) {
+			continue
+		}
+
+		nozzle.pendingParticles += nozzle.config.Rate * stepSize
+		for nozzle.pendingParticles >= 1 && len(particleCollection.Particles) < particleCollection.simulationConfig.MaxParticles {
+			nozzle.pendingParticles -= 1
+
+			acrossOffset := (particleCollection.rng.Float64() - 0.5) * nozzle.config.Width
+			alongOffset := particleCollection.rng.Float64() * nozzle.config.Speed * stepSize
+			position := []float64{
+				nozzle.config.PositionX + acrossOffset*nozzle.acrossX + alongOffset*nozzle.directionX,
+				nozzle.config.PositionY + acrossOffset*nozzle.acrossY + alongOffset*nozzle.directionY,
+				nozzle.config.PositionZ,
+			}[:particleCollection.dimensions]
+			emittedParticle := particleCollection.newParticle(position, nozzle.phaseIndex)
+			emittedParticle.Velocity.SetVec(xDIR, nozzle.config.Speed*nozzle.directionX)
+			emittedParticle.Velocity.SetVec(yDIR, nozzle.config.Speed*nozzle.directionY)
+			particleCollection.addParticle(emittedParticle)
+		}
+
+		// Particles owed while the simulation is full are dropped, rather than all being added at once later
+		nozzle.pendingParticles = min(nozzle.pendingParticles, 1)
+	}
+}
+
+// Remove every particle inside a sink.
+//
+// The remaining particles keep their order, along with the working arrays of each particle.
+func (particleCollection *ParticleCollection) removeParticlesInSinks() {
+	if len(particleCollection.simulationConfig.Sinks) == 0 {
+		return
+	}
+
+	keptParticles := 0
+	for particleIndex, p := range particleCollection.Particles {
+		if particleCollection.isInsideSink(p.Position.AtVec(xDIR), p.Position.AtVec(yDIR)) {
+			continue
+		}
+		particleCollection.Particles[keptParticles] = p
+		particleCollection.densities[keptParticles] = particleCollection.densities[particleIndex]
+		particleCollection.nearDensities[keptParticles] = particleCollection.nearDensities[particleIndex]
+		particleCollection.viscosities[keptParticles] = particleCollection.viscosities[particleIndex]
+		particleCollection.artificialStresses[keptParticles] = particleCollection.artificialStresses[particleIndex]
+		particleCollection.vorticities[keptParticles] = particleCollection.vorticities[particleIndex]
+		particleCollection.boundaryPressureTerms[keptParticles] = particleCollection.boundaryPressureTerms[particleIndex]
+		particleCollection.accelerations[keptParticles], particleCollection.accelerations[particleIndex] = particleCollection.accelerations[particleIndex], particleCollection.accelerations[keptParticles]
+		particleCollection.surfaceNormals[keptParticles], particleCollection.surfaceNormals[particleIndex] = particleCollection.surfaceNormals[particleIndex], particleCollection.surfaceNormals[keptParticles]
+		keptParticles += 1
+	}
+	if keptParticles == len(particleCollection.Particles) {
+		return
+	}
+
+	clear(particleCollection.Particles[keptParticles:])
+	particleCollection.Particles = particleCollection.Particles[:keptParticles]
+	particleCollection.densities = particleCollection.densities[:keptParticles]
+	particleCollection.nearDensities = particleCollection.nearDensities[:keptParticles]
+	particleCollection.viscosities = particleCollection.viscosities[:keptParticles]
+	particleCollection.artificialStresses = particleCollection.artificialStresses[:keptParticles]
+	particleCollection.vorticities = particleCollection.vorticities[:keptParticles]
+	particleCollection.boundaryPressureTerms = particleCollection.boundaryPressureTerms[:keptParticles]
+	particleCollection.accelerations = particleCollection.accelerations[:keptParticles]
+	particleCollection.surfaceNormals = particleCollection.surfaceNormals[:keptParticles]
+	particleCollection.spatialHashing.resize(keptParticles)
+	particleCollection.particlesChanged = true
+}
+
+// Check if a position is inside any sink
+func (particleCollection *ParticleCollection) isInsideSink(x float64, y float64) bool {
+	for _, sink := range particleCollection.simulationConfig.Sinks {
+		if sink.Contains(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add a particle to the collection, along with the working arrays for that particle
+func (particleCollection *ParticleCollection) addParticle(p *Particle) {
+	particleCollection.Particles = append(particleCollection.Particles, p)
+	particleCollection.densities = append(particleCollection.densities, 0)
+	particleCollection.nearDensities = append(particleCollection.nearDensities, 0)
+	particleCollection.viscosities = append(particleCollection.viscosities, 0)
+	particleCollection.artificialStresses = append(particleCollection.artificialStresses, [3][3]float64{})
+	particleCollection.vorticities = append(particleCollection.vorticities, [3]float64{})
+	particleCollection.boundaryPressureTerms = append(particleCollection.boundaryPressureTerms, 0)
+	particleCollection.accelerations = append(particleCollection.accelerations, particleCollection.newVector())
+	particleCollection.surfaceNormals = append(particleCollection.surfaceNormals, particleCollection.newVector())
+	particleCollection.spatialHashing.resize(len(particleCollection.Particles))
+	particleCollection.particlesChanged = true
+}
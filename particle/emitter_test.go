@@ -0,0 +1,110 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"testing"
+)
+
+// The working values of a particle, remembered to check they stay with the particle as others are removed
+type particleWorkingValues struct {
+	density       float64
+	nearDensity   float64
+	viscosity     float64
+	phase         int
+	acceleration  []float64
+	surfaceNormal []float64
+}
+
+// Check that every per-particle buffer has one entry for each particle
+func checkParticleBufferLengths(t *testing.T, particleCollection *ParticleCollection) {
+	t.Helper()
+	numParticles := len(particleCollection.Particles)
+	bufferLengths := map[string]int{
+		"densities":             len(particleCollection.densities),
+		"nearDensities":         len(particleCollection.nearDensities),
+		"viscosities":           len(particleCollection.viscosities),
+		"artificialStresses":    len(particleCollection.artificialStresses),
+		"vorticities":           len(particleCollection.vorticities),
+		"boundaryPressureTerms": len(particleCollection.boundaryPressureTerms),
+		"accelerations":         len(particleCollection.accelerations),
+		"surfaceNormals":        len(particleCollection.surfaceNormals),
+		"spatialHashing":        len(particleCollection.spatialHashing.particleHashes),
+	}
+	for bufferName, bufferLength := range bufferLengths {
+		if bufferLength != numParticles {
+			t.Fatalf("%v has %v entries for %v particles", bufferName, bufferLength, numParticles)
+		}
+	}
+}
+
+// Particles emitted into a sink, along with the particles already in the sink, must be removed without
+// separating the remaining particles from their densities, accelerations, and other working values
+func TestSinksKeepParticleBuffersAligned(t *testing.T) {
+	simulationConfig := config.CreateDefaultConfig()
+	simulationConfig.RandomSeed = 1
+	simulationConfig.GravityModel = "Acceleration"
+	simulationConfig.GravityStrength = 0.1
+	simulationConfig.ViscosityModel = "PowerLaw"
+	simulationConfig.SurfaceTensionCoefficient = 0.1
+	simulationConfig.NumParticles = 100
+	simulationConfig.Phases[0].NumParticles = 50
+	simulationConfig.Phases[0].ViscosityModel = "PowerLaw"
+	simulationConfig.Phases[0].Viscosity = 0.01
+	simulationConfig.Phases[0].Regions = []config.RegionConfig{{MinX: 300, MinY: 300, MaxX: 700, MaxY: 500}}
+	oilPhase := simulationConfig.Phases[0]
+	oilPhase.Name = "Oil"
+	oilPhase.RestDensity *= 0.8
+	oilPhase.Viscosity *= 2
+	oilPhase.Regions = []config.RegionConfig{{MinX: 300, MinY: 100, MaxX: 700, MaxY: 300}}
+	simulationConfig.Phases = append(simulationConfig.Phases, oilPhase)
+	simulationConfig.Emitters = []config.EmitterConfig{{PositionX: 500, PositionY: 250, Width: 40, Direction: 1.5, Speed: 2, Rate: 2, Phase: "Oil"}}
+	simulationConfig.Sinks = []config.RegionConfig{{MinX: 0, MinY: 350, MaxX: 1024, MaxY: 512}}
+	particleCollection := CreateParticleCollection(simulationConfig)
+
+	numRemoved, numEmitted := 0, 0
+	for step := 0; step < 100; step += 1 {
+		workingValues := make(map[*Particle]particleWorkingValues)
+		for particleIndex, p := range particleCollection.Particles {
+			workingValues[p] = particleWorkingValues{
+				density:       particleCollection.densities[particleIndex],
+				nearDensity:   particleCollection.nearDensities[particleIndex],
+				viscosity:     particleCollection.viscosities[particleIndex],
+				phase:         p.Phase,
+				acceleration:  append([]float64(nil), particleCollection.accelerations[particleIndex].RawVector().Data...),
+				surfaceNormal: append([]float64(nil), particleCollection.surfaceNormals[particleIndex].RawVector().Data...),
+			}
+		}
+
+		numBefore := len(particleCollection.Particles)
+		particleCollection.removeParticlesInSinks()
+		numRemoved += numBefore - len(particleCollection.Particles)
+		checkParticleBufferLengths(t, particleCollection)
+		for particleIndex, p := range particleCollection.Particles {
+			values := workingValues[p]
+			if particleCollection.densities[particleIndex] != values.density || particleCollection.nearDensities[particleIndex] != values.nearDensity ||
+				particleCollection.viscosities[particleIndex] != values.viscosity || p.Phase != values.phase ||
+				!vectorsClose(particleCollection.accelerations[particleIndex].RawVector().Data, values.acceleration) ||
+				!vectorsClose(particleCollection.surfaceNormals[particleIndex].RawVector().Data, values.surfaceNormal) {
+				t.Fatalf("particle %v lost its working values when particles were removed in step %v", particleIndex, step)
+			}
+		}
+
+		particleCollection.TickParticles()
+		checkParticleBufferLengths(t, particleCollection)
+		for particleIndex, p := range particleCollection.Particles {
+			if _, existed := workingValues[p]; !existed {
+				numEmitted += 1
+				if particleCollection.particlePhase(particleIndex).Name != "Oil" {
+					t.Fatalf("emitted particle %v has phase %q", particleIndex, particleCollection.particlePhase(particleIndex).Name)
+				}
+			}
+			if particleCollection.densities[particleIndex] <= 0 {
+				t.Fatalf("particle %v has density %v after step %v", particleIndex, particleCollection.densities[particleIndex], step)
+			}
+		}
+	}
+
+	if numRemoved == 0 || numEmitted == 0 {
+		t.Errorf("%v particles were emitted and %v removed, so the sink is not tested", numEmitted, numRemoved)
+	}
+}
@@ -0,0 +1,79 @@
+package particle
+
+import (
+	"log"
+	"math"
+)
+
+// An EquationOfState relates the density of a particle to its pressure
+type EquationOfState interface {
+	// The pressure of a particle with the given density, in a fluid with the given rest density
+	Pressure(density float64, restDensity float64) float64
+
+	// The speed of sound in the fluid at rest density, i.e. the square root of dP/dρ
+	SoundSpeed(restDensity float64) float64
+}
+
+// Create the equation of state with the given name, as specified in the SimulationConfig
+func newEquationOfState(equationOfStateName string, pressureCoefficient float64, soundSpeed float64, taitGamma float64) EquationOfState {
+	switch equationOfStateName {
+	case "Linear":
+		return &linearEquationOfState{stiffness: pressureCoefficient}
+	case "IdealGas":
+		return &idealGasEquationOfState{stiffness: pressureCoefficient}
+	case "Tait":
+		return &taitEquationOfState{soundSpeed: soundSpeed, gamma: taitGamma}
+	default:
+		log.Panicf("unknown equation of state %q", equationOfStateName)
+	}
+	return nil
+}
+
+// Pressure is proportional to the deviation from rest density, k(ρ-ρ0).
+//
+// Particles below rest density have negative pressure, and so attract one another.
+type linearEquationOfState struct {
+	stiffness float64
+}
+
+func (equationOfState *linearEquationOfState) Pressure(density float64, restDensity float64) float64 {
+	return equationOfState.stiffness * (density - restDensity)
+}
+
+func (equationOfState *linearEquationOfState) SoundSpeed(restDensity float64) float64 {
+	return math.Sqrt(equationOfState.stiffness)
+}
+
+// Pressure is proportional to density, kρ, as for an isothermal ideal gas.
+//
+// Pressure is never negative, so particles always repel one another.
+type idealGasEquationOfState struct {
+	stiffness float64
+}
+
+func (equationOfState *idealGasEquationOfState) Pressure(density float64, restDensity float64) float64 {
+	return equationOfState.stiffness * density
+}
+
+func (equationOfState *idealGasEquationOfState) SoundSpeed(restDensity float64) float64 {
+	return math.Sqrt(equationOfState.stiffness)
+}
+
+// The Tait equation of state used in weakly compressible SPH, B((ρ/ρ0)^γ - 1) with B = ρ0 c^2 / γ.
+//
+// The large exponent makes the fluid much stiffer under compression than under expansion.
+// The speed of sound should be roughly ten times the largest expected fluid velocity to keep density variations near one percent.
+// Pressure is clamped at zero below rest density, so particles near a free surface do not attract one another and clump together.
+type taitEquationOfState struct {
+	soundSpeed float64
+	gamma      float64
+}
+
+func (equationOfState *taitEquationOfState) Pressure(density float64, restDensity float64) float64 {
+	stiffness := restDensity * equationOfState.soundSpeed * equationOfState.soundSpeed / equationOfState.gamma
+	return max(stiffness*(math.Pow(density/restDensity, equationOfState.gamma)-1), 0)
+}
+
+func (equationOfState *taitEquationOfState) SoundSpeed(restDensity float64) float64 {
+	return equationOfState.soundSpeed
+}
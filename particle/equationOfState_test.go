@@ -0,0 +1,45 @@
+package particle
+
+import (
+	"math"
+	"testing"
+)
+
+// Each equation of state must give the pressure of its formula, and a sound speed that is the square root of dP/dρ at rest density
+func TestEquationsOfState(t *testing.T) {
+	const restDensity = 2.0
+	const stiffness = 3.0
+	const soundSpeed = 10.0
+	const taitGamma = 7.0
+	taitStiffness := restDensity * soundSpeed * soundSpeed / taitGamma
+
+	testCases := []struct {
+		name               string
+		expandedPressure   float64
+		compressedPressure float64
+		expectedSoundSpeed float64
+	}{
+		{"Linear", -stiffness, stiffness, math.Sqrt(stiffness)},
+		{"IdealGas", stiffness, 3 * stiffness, math.Sqrt(stiffness)},
+		{"Tait", 0, taitStiffness * (math.Pow(1.5, taitGamma) - 1), soundSpeed},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			equationOfState := newEquationOfState(testCase.name, stiffness, soundSpeed, taitGamma)
+			if pressure := equationOfState.Pressure(0.5*restDensity, restDensity); math.Abs(pressure-testCase.expandedPressure) > 1e-9 {
+				t.Errorf("pressure at half rest density is %v, expected %v", pressure, testCase.expandedPressure)
+			}
+			if pressure := equationOfState.Pressure(1.5*restDensity, restDensity); math.Abs(pressure-testCase.compressedPressure) > 1e-9*testCase.compressedPressure {
+				t.Errorf("pressure at 1.5 times rest density is %v, expected %v", pressure, testCase.compressedPressure)
+			}
+
+			// The Tait equation of state is clamped below rest density, so the derivative is taken from above
+			const densityStep = 1e-6
+			pressureDerivative := (equationOfState.Pressure(restDensity+densityStep, restDensity) - equationOfState.Pressure(restDensity, restDensity)) / densityStep
+			if sound := equationOfState.SoundSpeed(restDensity); math.Abs(sound-testCase.expectedSoundSpeed) > 1e-12 || math.Abs(sound*sound-pressureDerivative) > 1e-4*pressureDerivative {
+				t.Errorf("sound speed is %v, expected %v and the square root of dP/dρ = %v", sound, testCase.expectedSoundSpeed, pressureDerivative)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// A body force acting on the particles, as an acceleration depending on the position and velocity of each particle
+type forceFieldShape interface {
+	// Add the acceleration of a particle with the given position and velocity, multiplied by scale, to acceleration.
+	// Offsets from a point are measured across the periodic seams of the particle collection
+	addAcceleration(particleCollection *ParticleCollection, acceleration *mat.VecDense, position *mat.VecDense, velocity *mat.VecDense, scale float64)
+}
+
+// A force field, with the times it is active between and the modulation of its strength
+type forceField struct {
+	shape forceFieldShape
+
+	// Gravity fields are scaled by the buoyancy of each particle, and also act on rigid bodies
+	isGravity bool
+	vector    [3]float64
+
+	startTime   float64
+	endTime     float64
+	period      float64
+	modulation  float64
+	phaseOffset float64
+}
+
+// Create the force field described by the config
+func newForceField(forceFieldConfig config.ForceFieldConfig) *forceField {
+	field := &forceField{
+		vector:      [3]float64{forceFieldConfig.VectorX, forceFieldConfig.VectorY, forceFieldConfig.VectorZ},
+		startTime:   forceFieldConfig.StartTime,
+		endTime:     forceFieldConfig.EndTime,
+		period:      forceFieldConfig.Period,
+		modulation:  forceFieldConfig.Modulation,
+		phaseOffset: forceFieldConfig.PhaseOffset,
+	}
+	center := [3]float64{forceFieldConfig.CenterX, forceFieldConfig.CenterY, forceFieldConfig.CenterZ}
+
+	switch forceFieldConfig.Type {
+	case "Gravity":
+		field.isGravity = true
+		field.shape = &gravityField{acceleration: field.vector}
+	case "Radial":
+		field.shape = &radialField{center: center, radius: forceFieldConfig.Radius, strength: forceFieldConfig.Strength}
+	case "Vortex":
+		field.shape = &vortexField{center: center, radius: forceFieldConfig.Radius, strength: forceFieldConfig.Strength}
+	case "Wind":
+		field.shape = &windField{region: forceFieldConfig.Region, velocity: field.vector, strength: forceFieldConfig.Strength}
+	case "Drag":
+		field.shape = &windField{region: forceFieldConfig.Region, strength: forceFieldConfig.Strength}
+	default:
+		log.Panicf("unknown force field %q", forceFieldConfig.Type)
+	}
+	return field
+}
+
+// The scale of the strength of the field at the given simulated time, which is zero while the field is inactive
+func (field *forceField) strengthScale(simulatedTime float64) float64 {
+	if simulatedTime < field.startTime || (field.endTime != 0 && simulatedTime > field.endTime) {
+		return 0
+	}
+	if field.period <= 0 {
+		return 1
+	}
+	return 1 + field.modulation*math.Sin(2*math.Pi*simulatedTime/field.period+field.phaseOffset)
+}
+
+// Add the acceleration due to every force field on a particle at the predicted state to acceleration,
+// with gravity fields scaled by the buoyancy of the particle
+func (particleCollection *ParticleCollection) addForceFieldAccelerations(acceleration *mat.VecDense, targetParticle *Particle) {
+	for _, field := range particleCollection.forceFields {
+		scale := field.strengthScale(particleCollection.simulatedTime)
+		if scale == 0 {
+			continue
+		}
+		if field.isGravity {
+			scale *= particleCollection.buoyancyScale(targetParticle)
+		}
+		field.shape.addAcceleration(particleCollection, acceleration, targetParticle.PredictedPosition, targetParticle.PredictedVelocity, scale)
+	}
+}
+
+// The acceleration due to the gravity force fields on a rigid body, within the x-y plane
+func (particleCollection *ParticleCollection) rigidBodyForceFieldAcceleration() (float64, float64) {
+	accelerationX, accelerationY := 0.0, 0.0
+	for _, field := range particleCollection.forceFields {
+		if field.isGravity {
+			scale := field.strengthScale(particleCollection.simulatedTime)
+			accelerationX += scale * field.vector[xDIR]
+			accelerationY += scale * field.vector[yDIR]
+		}
+	}
+	return accelerationX, accelerationY
+}
+
+// A uniform acceleration
+type gravityField struct {
+	acceleration [3]float64
+}
+
+func (field *gravityField) addAcceleration(particleCollection *ParticleCollection, acceleration *mat.VecDense, position *mat.VecDense, velocity *mat.VecDense, scale float64) {
+	for direction := 0; direction < acceleration.Len(); direction += 1 {
+		acceleration.SetVec(direction, acceleration.AtVec(direction)+scale*field.acceleration[direction])
+	}
+}
+
+// An acceleration towards (or away from) a point
+type radialField struct {
+	center   [3]float64
+	radius   float64
+	strength float64
+}
+
+func (field *radialField) addAcceleration(particleCollection *ParticleCollection, acceleration *mat.VecDense, position *mat.VecDense, velocity *mat.VecDense, scale float64) {
+	var offset [3]float64
+	for direction := 0; direction < position.Len(); direction += 1 {
+		offset[direction] = particleCollection.periodicOffset(field.center[direction]-position.AtVec(direction), direction)
+	}
+	distance := vectorMagnitude(offset)
+	magnitude := scale * falloffStrength(field.strength, field.radius, distance)
+	if distance == 0 || magnitude == 0 {
+		return
+	}
+	for direction := 0; direction < acceleration.Len(); direction += 1 {
+		acceleration.SetVec(direction, acceleration.AtVec(direction)+magnitude*offset[direction]/distance)
+	}
+}
+
+// An acceleration around the line through a point parallel to the z axis
+type vortexField struct {
+	center   [3]float64
+	radius   float64
+	strength float64
+}
+
+func (field *vortexField) addAcceleration(particleCollection *ParticleCollection, acceleration *mat.VecDense, position *mat.VecDense, velocity *mat.VecDense, scale float64) {
+	offsetX := particleCollection.periodicOffset(position.AtVec(xDIR)-field.center[xDIR], xDIR)
+	offsetY := particleCollection.periodicOffset(position.AtVec(yDIR)-field.center[yDIR], yDIR)
+	distance := math.Hypot(offsetX, offsetY)
+	magnitude := scale * falloffStrength(field.strength, field.radius, distance)
+	if distance == 0 || magnitude == 0 {
+		return
+	}
+
+	// Remember - y axis starts with 0 at the top and increases *downwards*, so (y, -x) is counterclockwise on screen
+	acceleration.SetVec(xDIR, acceleration.AtVec(xDIR)+magnitude*offsetY/distance)
+	acceleration.SetVec(yDIR, acceleration.AtVec(yDIR)-magnitude*offsetX/distance)
+}
+
+// A relaxation of the velocity towards a fixed velocity within a region, which is drag when that velocity is zero
+type windField struct {
+	region   config.RegionConfig
+	velocity [3]float64
+	strength float64
+}
+
+func (field *windField) addAcceleration(particleCollection *ParticleCollection, acceleration *mat.VecDense, position *mat.VecDense, velocity *mat.VecDense, scale float64) {
+	if field.region.Area() > 0 && !field.region.Contains(position.AtVec(xDIR), position.AtVec(yDIR)) {
+		return
+	}
+	for direction := 0; direction < acceleration.Len(); direction += 1 {
+		relativeVelocity := field.velocity[direction] - velocity.AtVec(direction)
+		acceleration.SetVec(direction, acceleration.AtVec(direction)+scale*field.strength*relativeVelocity)
+	}
+}
+
+// The strength of a field at the given distance from its center, falling linearly to zero at the radius if the radius is positive
+func falloffStrength(strength float64, radius float64, distance float64) float64 {
+	if radius <= 0 {
+		return strength
+	}
+	return strength * max(1-distance/radius, 0)
+}
@@ -0,0 +1,58 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// Create a collection periodic along x with a single particle at the given distance to the left of centerX,
+// pulled by a radial field, spun by a vortex field, and poked by the interaction point, all centered at centerX
+func createPeriodicFieldCollection(centerX float64, particleX float64) *ParticleCollection {
+	simulationConfig := config.CreateDefaultConfig()
+	simulationConfig.PeriodicX = true
+	simulationConfig.GravityStrength = 0
+	simulationConfig.NumParticles = 0
+	simulationConfig.Phases[0].NumParticles = 0
+	simulationConfig.ForceFields = []config.ForceFieldConfig{
+		{Type: "Radial", CenterX: centerX, CenterY: 250, Radius: 50, Strength: 1},
+		{Type: "Vortex", CenterX: centerX, CenterY: 250, Radius: 50, Strength: 2},
+	}
+	particleCollection := CreateParticleCollection(simulationConfig)
+	particleCollection.addParticle(particleCollection.newParticle([]float64{particleX, 250}, 0))
+	particleCollection.SetInteraction(centerX, 250, true)
+	return particleCollection
+}
+
+// Force fields and the interaction point must act across the periodic seam as they do away from it
+func TestForceFieldsActAcrossPeriodicSeam(t *testing.T) {
+	seamCollection := createPeriodicFieldCollection(10, 1014)
+	middleCollection := createPeriodicFieldCollection(522, 502)
+
+	seamAcceleration, middleAcceleration := seamCollection.newVector(), middleCollection.newVector()
+	seamCollection.addForceFieldAccelerations(seamAcceleration, seamCollection.Particles[0])
+	middleCollection.addForceFieldAccelerations(middleAcceleration, middleCollection.Particles[0])
+	if seamAcceleration.AtVec(xDIR) <= 0 || !vectorsClose(seamAcceleration.RawVector().Data, middleAcceleration.RawVector().Data) {
+		t.Errorf("force field acceleration is %v across the seam, but %v away from it",
+			seamAcceleration.RawVector().Data, middleAcceleration.RawVector().Data)
+	}
+
+	for _, particleCollection := range []*ParticleCollection{seamCollection, middleCollection} {
+		particleCollection.spatialHashing.updateSpatialHashing(particleCollection.Particles)
+		particleCollection.applyInteraction(1)
+	}
+	seamVelocity, middleVelocity := seamCollection.Particles[0].Velocity, middleCollection.Particles[0].Velocity
+	if seamVelocity.AtVec(xDIR) <= 0 || !vectorsClose(seamVelocity.RawVector().Data, middleVelocity.RawVector().Data) {
+		t.Errorf("interaction gives a velocity of %v across the seam, but %v away from it", seamVelocity.RawVector().Data, middleVelocity.RawVector().Data)
+	}
+}
+
+// Check if two vectors are equal up to rounding
+func vectorsClose(a []float64, b []float64) bool {
+	for direction := range a {
+		if math.Abs(a[direction]-b[direction]) > 1e-9*(math.Abs(a[direction])+math.Abs(b[direction])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package particle
+
+import "math"
+
+// Get gravity at the current simulated time, within the x-y plane.
+//
+// Gravity has the GravityStrength, turned from straight down by the GravityMotion (or GravityAngle if there is none)
+// and any tilt from TiltGravity. This is only an acceleration if the GravityModel is "Acceleration", see gravityAcceleration.
+func (particleCollection *ParticleCollection) Gravity() (float64, float64) {
+	gravityAngle := particleCollection.simulationConfig.GravityAngle
+	if particleCollection.gravityMotion != nil {
+		_, _, gravityAngle = particleCollection.gravityMotion.pose(particleCollection.simulatedTime)
+	}
+	gravityAngle += particleCollection.gravityTilt
+
+	// Remember - y axis starts with 0 at the top and increases *downwards*, so an angle of zero points along +y
+	gravityStrength := particleCollection.simulationConfig.GravityStrength
+	return gravityStrength * math.Sin(gravityAngle), gravityStrength * math.Cos(gravityAngle)
+}
+
+// Get the acceleration due to gravity of a particle (or rigid body) with the given density
+func (particleCollection *ParticleCollection) gravityAcceleration(density float64) (float64, float64) {
+	gravityX, gravityY := particleCollection.Gravity()
+	if particleCollection.gravityPerVolume {
+		return gravityX / density, gravityY / density
+	}
+	return gravityX, gravityY
+}
+
+// Tilt gravity by the given angle (in radians), counterclockwise as seen on screen, in addition to any previous tilt.
+// This is used to tilt the container interactively, e.g. with the arrow keys in the GUI
+func (particleCollection *ParticleCollection) TiltGravity(angle float64) {
+	particleCollection.gravityTilt += angle
+}
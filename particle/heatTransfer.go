@@ -0,0 +1,149 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+)
+
+// Heat conduction follows Cleary and Monaghan (1999), "Conduction Modelling Using Smoothed Particle Hydrodynamics".
+//
+// The rate of change of temperature of each particle is
+// dT_i/dt = Σ (m_j / ρ_j) (4 α_i α_j / (α_i + α_j)) (T_i - T_j) (r_ij · ∇W_ij) / (|r_ij|^2 + η^2)
+// where α is the thermal diffusivity of each phase. The harmonic mean of the diffusivities keeps heat flux continuous
+// across an interface between phases, and η = 0.1 h avoids the singularity when particles are close together.
+
+// A heat source, as a region of the simulation
+type heatSource struct {
+	region      config.RegionConfig
+	temperature float64
+	rate        float64
+}
+
+// Create a heat source, converting a wall to the region within the thickness of that edge of the simulation
+func newHeatSource(heatSourceConfig config.HeatSourceConfig, simulationConfig *config.SimulationConfig) *heatSource {
+	width := float64(simulationConfig.SimulationWidth)
+	height := float64(simulationConfig.SimulationHeight)
+	thickness := heatSourceConfig.Thickness
+	if thickness == 0 {
+		thickness = simulationConfig.SmoothingKernelRadius
+	}
+
+	region := heatSourceConfig.Region
+	switch heatSourceConfig.Wall {
+	case "":
+	case "Left":
+		region = config.RegionConfig{MinX: 0, MinY: 0, MaxX: thickness, MaxY: height}
+	case "Right":
+		region = config.RegionConfig{MinX: width - thickness, MinY: 0, MaxX: width, MaxY: height}
+	case "Top":
+		region = config.RegionConfig{MinX: 0, MinY: 0, MaxX: width, MaxY: thickness}
+	case "Bottom":
+		region = config.RegionConfig{MinX: 0, MinY: height - thickness, MaxX: width, MaxY: height}
+	default:
+		log.Panicf("unknown heat source wall %q", heatSourceConfig.Wall)
+	}
+
+	return &heatSource{
+		region:      region,
+		temperature: heatSourceConfig.Temperature,
+		rate:        heatSourceConfig.Rate,
+	}
+}
+
+// Conduct heat between neighboring particles, and then heat or cool the particles inside each heat source.
+//
+// Requires the densities and spatial hashing to be up to date, so this is run after the solver step.
+func (particleCollection *ParticleCollection) transferHeat(stepSize float64) {
+	conductionEnabled := false
+	for _, phase := range particleCollection.simulationConfig.Phases {
+		conductionEnabled = conductionEnabled || phase.ThermalDiffusivity != 0
+	}
+	if !conductionEnabled && len(particleCollection.heatSources) == 0 {
+		return
+	}
+
+	// The rates are all found before any temperature changes, so that the result does not depend on the particle order
+	for len(particleCollection.temperatureRates) < len(particleCollection.Particles) {
+		particleCollection.temperatureRates = append(particleCollection.temperatureRates, 0)
+	}
+	if conductionEnabled {
+		particleCollection.runParticleWorkers(particleCollection.calculateTemperatureRateWorker)
+	}
+
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			if conductionEnabled {
+				targetParticle.Temperature += stepSize * particleCollection.temperatureRates[particleIndex]
+			}
+
+			for _, source := range particleCollection.heatSources {
+				if source.region.Contains(targetParticle.Position.AtVec(xDIR), targetParticle.Position.AtVec(yDIR)) {
+					blend := min(source.rate*stepSize, 1)
+					targetParticle.Temperature += blend * (source.temperature - targetParticle.Temperature)
+				}
+			}
+		}
+	})
+}
+
+// Calculate the rate of change of temperature of each particle due to conduction,
+// storing the result in particleCollection.temperatureRates
+func (particleCollection *ParticleCollection) calculateTemperatureRateWorker(particleIndexChannel <-chan int) {
+	displacementVec := particleCollection.newVector()
+	smoothingLengthSquared := 0.01 * particleCollection.simulationConfig.SmoothingKernelRadius * particleCollection.simulationConfig.SmoothingKernelRadius
+	for particleIndex := range particleIndexChannel {
+		targetParticle := particleCollection.Particles[particleIndex]
+		targetDiffusivity := particleCollection.particlePhase(particleIndex).ThermalDiffusivity
+		temperatureRate := 0.0
+
+		neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+		for _, neighborIndex := range neighboringParticleIndices {
+			if particleIndex == neighborIndex {
+				continue
+			}
+
+			neighborParticle := particleCollection.Particles[neighborIndex]
+			neighborPhase := particleCollection.particlePhase(neighborIndex)
+			diffusivitySum := targetDiffusivity + neighborPhase.ThermalDiffusivity
+			if diffusivitySum == 0 {
+				continue
+			}
+
+			particleCollection.calculateDisplacement(displacementVec, targetParticle.Position, neighborParticle.Position)
+			displacementMagnitude := displacementVec.Norm(2)
+
+			// r_ij · ∇W_ij is the distance multiplied by the derivative of the kernel, as the gradient points along r_ij
+			displacementDotGradient := displacementMagnitude * particleCollection.densityKernel.Gradient(displacementMagnitude)
+			sharedDiffusivity := 4 * targetDiffusivity * neighborPhase.ThermalDiffusivity / diffusivitySum
+			neighborVolume := neighborPhase.ParticleMass / particleCollection.densities[neighborIndex]
+			temperatureDifference := targetParticle.Temperature - neighborParticle.Temperature
+			temperatureRate += neighborVolume * sharedDiffusivity * temperatureDifference * displacementDotGradient / (displacementMagnitude*displacementMagnitude + smoothingLengthSquared)
+		}
+		particleCollection.temperatureRates[particleIndex] = temperatureRate
+	}
+}
+
+// The Boussinesq scale of gravity on a particle, 1 - β (T - T_0)
+func (particleCollection *ParticleCollection) buoyancyScale(targetParticle *Particle) float64 {
+	simulationConfig := particleCollection.simulationConfig
+	return 1 - simulationConfig.ThermalExpansionCoefficient*(targetParticle.Temperature-simulationConfig.ReferenceTemperature)
+}
+
+// The largest difference of any phase or heat source temperature from the ReferenceTemperature,
+// used to scale temperatures when coloring particles
+func (particleCollection *ParticleCollection) temperatureColorScale() float64 {
+	referenceTemperature := particleCollection.simulationConfig.ReferenceTemperature
+	temperatureScale := 0.0
+	for _, phase := range particleCollection.simulationConfig.Phases {
+		temperatureScale = max(temperatureScale, math.Abs(phase.Temperature-referenceTemperature))
+	}
+	for _, source := range particleCollection.heatSources {
+		temperatureScale = max(temperatureScale, math.Abs(source.temperature-referenceTemperature))
+	}
+	if temperatureScale == 0 {
+		return 1
+	}
+	return temperatureScale
+}
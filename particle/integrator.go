@@ -0,0 +1,152 @@
+package particle
+
+import (
+	"log"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// An Integrator advances the state of every particle in a collection by a single step.
+//
+// Integrators decide at which states the accelerations are evaluated (by setting the
+// predicted position and velocity of each particle before calling calculateAccelerations)
+// and how those accelerations are combined into the new position and velocity.
+type Integrator interface {
+	Integrate(particleCollection *ParticleCollection, stepSize float64)
+}
+
+// Create the integrator with the given name, as specified in the SimulationConfig
+func newIntegrator(integratorName string) Integrator {
+	switch integratorName {
+	case "SymplecticEuler":
+		return &symplecticEulerIntegrator{}
+	case "VelocityVerlet", "Leapfrog":
+		return &velocityVerletIntegrator{}
+	case "RK4":
+		return &rk4Integrator{}
+	default:
+		log.Panicf("unknown integrator %q", integratorName)
+	}
+	return nil
+}
+
+// Semi-implicit (symplectic) Euler integration.
+//
+// Accelerations are evaluated at a look-ahead position (the current position advanced by the current velocity),
+// then the velocity is updated followed by the position.
+type symplecticEulerIntegrator struct{}
+
+func (integrator *symplecticEulerIntegrator) Integrate(particleCollection *ParticleCollection, stepSize float64) {
+	for _, p := range particleCollection.Particles {
+		p.updatePredictedPosition(stepSize)
+		p.PredictedVelocity.CopyVec(p.Velocity)
+	}
+	particleCollection.calculateAccelerations()
+
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, stepSize, particleCollection.accelerations[particleIndex])
+			targetParticle.Position.AddScaledVec(targetParticle.Position, stepSize, targetParticle.Velocity)
+			particleCollection.handleSimulationEdges(particleIndex)
+		}
+	})
+}
+
+// Velocity Verlet (kick-drift-kick leapfrog) integration.
+//
+// The velocity is advanced by half a step using the accelerations from the end of the previous step,
+// the position is advanced a full step using this half step velocity, and finally the velocity is
+// advanced the remaining half step using the accelerations at the new position.
+type velocityVerletIntegrator struct {
+	// Set once the accelerations at the current state have been calculated,
+	// as the very first step has no previous step to take them from.
+	// The accelerations are also recalculated whenever particles are added or removed
+	hasInitialAccelerations bool
+}
+
+func (integrator *velocityVerletIntegrator) Integrate(particleCollection *ParticleCollection, stepSize float64) {
+	if !integrator.hasInitialAccelerations || particleCollection.particlesChanged {
+		for _, p := range particleCollection.Particles {
+			p.resetPredictedState()
+		}
+		particleCollection.calculateAccelerations()
+		integrator.hasInitialAccelerations = true
+	}
+
+	// Kick and drift
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, stepSize/2, particleCollection.accelerations[particleIndex])
+			targetParticle.Position.AddScaledVec(targetParticle.Position, stepSize, targetParticle.Velocity)
+			particleCollection.handleSimulationEdges(particleIndex)
+			targetParticle.resetPredictedState()
+		}
+	})
+	particleCollection.calculateAccelerations()
+
+	// Kick
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, stepSize/2, particleCollection.accelerations[particleIndex])
+		}
+	})
+}
+
+// Classical fourth order Runge-Kutta integration.
+//
+// Accelerations are evaluated four times per step, so this is roughly four times as expensive as the other integrators.
+// Collisions with the edges of the simulation are only handled once the full step is taken.
+type rk4Integrator struct {
+	// The weighted sums of the velocities and accelerations of each stage, for each particle
+	positionIncrements []*mat.VecDense
+	velocityIncrements []*mat.VecDense
+}
+
+var (
+	rk4StageOffsets = []float64{0.0, 0.5, 0.5, 1.0}
+	rk4StageWeights = []float64{1.0, 2.0, 2.0, 1.0}
+)
+
+func (integrator *rk4Integrator) Integrate(particleCollection *ParticleCollection, stepSize float64) {
+	for len(integrator.positionIncrements) < len(particleCollection.Particles) {
+		integrator.positionIncrements = append(integrator.positionIncrements, particleCollection.newVector())
+		integrator.velocityIncrements = append(integrator.velocityIncrements, particleCollection.newVector())
+	}
+
+	for particleIndex, p := range particleCollection.Particles {
+		p.resetPredictedState()
+		integrator.positionIncrements[particleIndex].Zero()
+		integrator.velocityIncrements[particleIndex].Zero()
+	}
+
+	for stageIndex := range rk4StageOffsets {
+		if stageIndex > 0 {
+			// Move the predicted state to the next stage using the derivatives of the previous stage
+			stageOffset := rk4StageOffsets[stageIndex] * stepSize
+			for particleIndex, p := range particleCollection.Particles {
+				p.PredictedPosition.AddScaledVec(p.Position, stageOffset, p.PredictedVelocity)
+				p.PredictedVelocity.AddScaledVec(p.Velocity, stageOffset, particleCollection.accelerations[particleIndex])
+			}
+		}
+
+		particleCollection.calculateAccelerations()
+
+		stageWeight := rk4StageWeights[stageIndex]
+		for particleIndex, p := range particleCollection.Particles {
+			integrator.positionIncrements[particleIndex].AddScaledVec(integrator.positionIncrements[particleIndex], stageWeight, p.PredictedVelocity)
+			integrator.velocityIncrements[particleIndex].AddScaledVec(integrator.velocityIncrements[particleIndex], stageWeight, particleCollection.accelerations[particleIndex])
+		}
+	}
+
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Position.AddScaledVec(targetParticle.Position, stepSize/6, integrator.positionIncrements[particleIndex])
+			targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, stepSize/6, integrator.velocityIncrements[particleIndex])
+			particleCollection.handleSimulationEdges(particleIndex)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// Particles falling freely under gravity must keep their kinetic plus gravitational potential energy.
+//
+// Symplectic Euler moves each particle with its new velocity, so the particles fall slightly too far and lose
+// about the kinetic energy divided by the number of steps. Velocity Verlet and RK4 are exact under constant acceleration
+func TestIntegratorsConserveEnergyInFreeFall(t *testing.T) {
+	const numSteps = 100
+	testCases := []struct {
+		integrator    string
+		relativeDrift float64
+	}{
+		{"SymplecticEuler", 2.0 / numSteps},
+		{"VelocityVerlet", 1e-9},
+		{"RK4", 1e-9},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.integrator, func(t *testing.T) {
+			simulationConfig := config.CreateDefaultConfig()
+			simulationConfig.Integrator = testCase.integrator
+			simulationConfig.GravityStrength = 0.0001
+			simulationConfig.NumParticles = 0
+			simulationConfig.Phases[0].NumParticles = 0
+			particleCollection := CreateParticleCollection(simulationConfig)
+
+			// The particles are further apart than the SmoothingKernelRadius, so they do not interact
+			for i := 0; i < 5; i += 1 {
+				particleCollection.addParticle(particleCollection.newParticle([]float64{100 + 100*float64(i), 100}, 0))
+			}
+
+			// The potential energy uses the densities of the previous step, so start counting from the first step
+			particleCollection.TickParticles()
+			initialEnergy := particleCollection.KineticEnergy() + particleCollection.GravitationalPotentialEnergy()
+			for step := 1; step < numSteps; step += 1 {
+				particleCollection.TickParticles()
+			}
+			kineticEnergy := particleCollection.KineticEnergy()
+			energyDrift := kineticEnergy + particleCollection.GravitationalPotentialEnergy() - initialEnergy
+			if kineticEnergy == 0 || math.Abs(energyDrift) > testCase.relativeDrift*kineticEnergy {
+				t.Errorf("energy drifted by %v after %v steps, with a final kinetic energy of %v", energyDrift, numSteps, kineticEnergy)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package particle
+
+import "math"
+
+// Set the point that particles within InteractionRadius are pulled towards, or pushed away from if pull is false,
+// until ClearInteraction is called. This is used to poke at the fluid, e.g. while a mouse button is held in the GUI
+func (particleCollection *ParticleCollection) SetInteraction(positionX float64, positionY float64, pull bool) {
+	particleCollection.interactionX = positionX
+	particleCollection.interactionY = positionY
+	particleCollection.interactionStrength = particleCollection.simulationConfig.InteractionStrength
+	if !pull {
+		particleCollection.interactionStrength *= -1
+	}
+}
+
+// Stop pulling or pushing particles
+func (particleCollection *ParticleCollection) ClearInteraction() {
+	particleCollection.interactionStrength = 0
+}
+
+// Accelerate the particles near the interaction point over a step, with an acceleration of InteractionStrength
+// at the point falling linearly to zero at InteractionRadius. In three dimensions the distance is only
+// measured within the x-y plane, so particles are affected through the entire depth of the simulation.
+//
+// Requires the spatial hashing to be up to date, so this is run after the solver step.
+func (particleCollection *ParticleCollection) applyInteraction(stepSize float64) {
+	if particleCollection.interactionStrength == 0 {
+		return
+	}
+
+	interactionRadius := particleCollection.simulationConfig.InteractionRadius
+	nearbyParticleIndices := particleCollection.spatialHashing.getParticleIndicesNearPoint(particleCollection.interactionX, particleCollection.interactionY, interactionRadius)
+	for _, particleIndex := range nearbyParticleIndices {
+		targetParticle := particleCollection.Particles[particleIndex]
+		interactionX, interactionY := particleCollection.nearestPeriodicImage(particleCollection.interactionX, particleCollection.interactionY, targetParticle.Position)
+		offsetX := interactionX - targetParticle.Position.AtVec(xDIR)
+		offsetY := interactionY - targetParticle.Position.AtVec(yDIR)
+		distance := math.Hypot(offsetX, offsetY)
+		magnitude := falloffStrength(particleCollection.interactionStrength, interactionRadius, distance)
+		if distance == 0 || magnitude == 0 {
+			continue
+		}
+
+		targetParticle.Velocity.SetVec(xDIR, targetParticle.Velocity.AtVec(xDIR)+stepSize*magnitude*offsetX/distance)
+		targetParticle.Velocity.SetVec(yDIR, targetParticle.Velocity.AtVec(yDIR)+stepSize*magnitude*offsetY/distance)
+	}
+}
@@ -0,0 +1,130 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// An obstacle inside the simulation, such as a cylinder, weir, or funnel wall.
+//
+// Obstacles are either static, or move along a prescribed trajectory such as a paddle, piston, or stirrer.
+// Moving obstacles are not pushed back by the fluid.
+type Obstacle struct {
+	placedShape
+
+	// The prescribed trajectory of the obstacle, or nil if the obstacle is static
+	motion obstacleMotion
+
+	// The boundary particles of the obstacle, if the BoundaryMode is "BoundaryParticles"
+	shapeBoundary
+}
+
+func newObstacle(obstacleConfig config.ObstacleConfig) *Obstacle {
+	obstacle := &Obstacle{
+		placedShape: placedShape{
+			Position: mat.NewVecDense(2, []float64{obstacleConfig.PositionX, obstacleConfig.PositionY}),
+			Angle:    obstacleConfig.Angle,
+			Velocity: mat.NewVecDense(2, nil),
+			shape:    newShape(obstacleConfig.ShapeConfig),
+		},
+		motion: newObstacleMotion(obstacleConfig.Motion, obstacleConfig.PositionX, obstacleConfig.PositionY, obstacleConfig.Angle),
+	}
+	if obstacle.motion != nil {
+		positionX, positionY, angle := obstacle.motion.pose(0)
+		obstacle.Position.SetVec(xDIR, positionX)
+		obstacle.Position.SetVec(yDIR, positionY)
+		obstacle.Angle = angle
+	}
+	return obstacle
+}
+
+// Move every moving obstacle along its trajectory to its pose at the end of the step, starting from the current simulated time.
+//
+// The velocities of each obstacle are set to the average over the step, so particles hit by the obstacle
+// are moved with it. The boundary particles of each moving obstacle are moved along with the obstacle.
+func (particleCollection *ParticleCollection) moveObstacles(stepSize float64) {
+	anyObstacleMoved := false
+	for _, obstacle := range particleCollection.Obstacles {
+		if obstacle.motion == nil {
+			continue
+		}
+		anyObstacleMoved = true
+
+		positionX, positionY, angle := obstacle.motion.pose(particleCollection.simulatedTime + stepSize)
+		obstacle.Velocity.SetVec(xDIR, (positionX-obstacle.Position.AtVec(xDIR))/stepSize)
+		obstacle.Velocity.SetVec(yDIR, (positionY-obstacle.Position.AtVec(yDIR))/stepSize)
+		obstacle.AngularVelocity = (angle - obstacle.Angle) / stepSize
+		obstacle.Position.SetVec(xDIR, positionX)
+		obstacle.Position.SetVec(yDIR, positionY)
+		obstacle.Angle = angle
+		particleCollection.moveShapeBoundary(&obstacle.placedShape, &obstacle.shapeBoundary)
+	}
+
+	if anyObstacleMoved && particleCollection.boundarySpatialHashing != nil {
+		particleCollection.boundarySpatialHashing.updateSpatialHashing(particleCollection.boundaryParticles)
+	}
+}
+
+// Move a particle that is inside an obstacle to the surface of the obstacle.
+//
+// If the particle is moving into the obstacle, relative to the velocity of the surface of the obstacle, the normal
+// component of the relative velocity is reflected and scaled by the CollisionDampingCoefficient, and the tangential
+// component is reduced by Coulomb friction, in proportion to the change in normal velocity and the CollisionFrictionCoefficient.
+func (particleCollection *ParticleCollection) handleObstacleCollisions(targetParticle *Particle) {
+	simulationConfig := particleCollection.simulationConfig
+	for _, obstacle := range particleCollection.Obstacles {
+		positionX, positionY := particleCollection.nearestPeriodicImage(targetParticle.Position.AtVec(xDIR), targetParticle.Position.AtVec(yDIR), obstacle.Position)
+		if !obstacle.withinBoundingRadius(positionX, positionY) {
+			continue
+		}
+		distance, normalX, normalY := obstacle.signedDistance(positionX, positionY)
+		if distance >= 0 {
+			continue
+		}
+
+		// The contact point is the closest point on the surface of the obstacle
+		targetParticle.Position.SetVec(xDIR, positionX-distance*normalX)
+		targetParticle.Position.SetVec(yDIR, positionY-distance*normalY)
+		surfaceVelocityX, surfaceVelocityY := obstacle.velocityAt(
+			targetParticle.Position.AtVec(xDIR)-obstacle.Position.AtVec(xDIR),
+			targetParticle.Position.AtVec(yDIR)-obstacle.Position.AtVec(yDIR),
+		)
+
+		velocityX := targetParticle.Velocity.AtVec(xDIR) - surfaceVelocityX
+		velocityY := targetParticle.Velocity.AtVec(yDIR) - surfaceVelocityY
+		normalVelocity := velocityX*normalX + velocityY*normalY
+		if normalVelocity >= 0 {
+			continue
+		}
+
+		tangentialVelocityX := velocityX - normalVelocity*normalX
+		tangentialVelocityY := velocityY - normalVelocity*normalY
+		tangentialSpeed := math.Hypot(tangentialVelocityX, tangentialVelocityY)
+		frictionScale := 0.0
+		if tangentialSpeed > 0 {
+			normalSpeedChange := -(1 + simulationConfig.CollisionDampingCoefficient) * normalVelocity
+			frictionScale = max(1-simulationConfig.CollisionFrictionCoefficient*normalSpeedChange/tangentialSpeed, 0)
+		}
+
+		reflectedNormalVelocity := -simulationConfig.CollisionDampingCoefficient * normalVelocity
+		targetParticle.Velocity.SetVec(xDIR, surfaceVelocityX+reflectedNormalVelocity*normalX+frictionScale*tangentialVelocityX)
+		targetParticle.Velocity.SetVec(yDIR, surfaceVelocityY+reflectedNormalVelocity*normalY+frictionScale*tangentialVelocityY)
+	}
+}
+
+// Move a (predicted) position that is inside an obstacle to the surface of the obstacle
+func (particleCollection *ParticleCollection) projectOutOfObstacles(position *mat.VecDense) {
+	for _, obstacle := range particleCollection.Obstacles {
+		positionX, positionY := particleCollection.nearestPeriodicImage(position.AtVec(xDIR), position.AtVec(yDIR), obstacle.Position)
+		if !obstacle.withinBoundingRadius(positionX, positionY) {
+			continue
+		}
+		distance, normalX, normalY := obstacle.signedDistance(positionX, positionY)
+		if distance < 0 {
+			position.SetVec(xDIR, positionX-distance*normalX)
+			position.SetVec(yDIR, positionY-distance*normalY)
+		}
+	}
+}
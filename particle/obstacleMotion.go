@@ -0,0 +1,116 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+)
+
+// A prescribed trajectory of an obstacle (or of the direction of gravity), giving the position of the centroid
+// and the angle at any simulated time
+type obstacleMotion interface {
+	pose(simulatedTime float64) (positionX float64, positionY float64, angle float64)
+}
+
+// Create the motion described by the config, starting from the given position and angle
+func newObstacleMotion(motionConfig config.MotionConfig, positionX float64, positionY float64, angle float64) obstacleMotion {
+	switch motionConfig.Type {
+	case "", "Static":
+		return nil
+	case "Oscillation":
+		if motionConfig.Period <= 0 {
+			log.Panicf("oscillating motion must have a positive period, got %v", motionConfig.Period)
+		}
+		return &oscillationMotion{
+			positionX:      positionX,
+			positionY:      positionY,
+			angle:          angle,
+			amplitudeX:     motionConfig.AmplitudeX,
+			amplitudeY:     motionConfig.AmplitudeY,
+			angleAmplitude: motionConfig.AngleAmplitude,
+			period:         motionConfig.Period,
+			phaseOffset:    motionConfig.PhaseOffset,
+		}
+	case "Rotation":
+		return &rotationMotion{
+			positionX:       positionX,
+			positionY:       positionY,
+			angle:           angle,
+			angularVelocity: motionConfig.AngularVelocity,
+		}
+	case "Keyframes":
+		if len(motionConfig.Keyframes) == 0 {
+			log.Panicf("keyframed motion must have at least one keyframe")
+		}
+		for keyframeIndex := 1; keyframeIndex < len(motionConfig.Keyframes); keyframeIndex += 1 {
+			if motionConfig.Keyframes[keyframeIndex].Time <= motionConfig.Keyframes[keyframeIndex-1].Time {
+				log.Panicf("keyframes must be in increasing order of time, got %v", motionConfig.Keyframes)
+			}
+		}
+		return &keyframeMotion{
+			keyframes: motionConfig.Keyframes,
+			loop:      motionConfig.Loop,
+		}
+	default:
+		log.Panicf("unknown motion %q", motionConfig.Type)
+	}
+	return nil
+}
+
+type oscillationMotion struct {
+	positionX float64
+	positionY float64
+	angle     float64
+
+	amplitudeX     float64
+	amplitudeY     float64
+	angleAmplitude float64
+	period         float64
+	phaseOffset    float64
+}
+
+func (motion *oscillationMotion) pose(simulatedTime float64) (float64, float64, float64) {
+	displacement := math.Sin(2*math.Pi*simulatedTime/motion.period + motion.phaseOffset)
+	return motion.positionX + motion.amplitudeX*displacement, motion.positionY + motion.amplitudeY*displacement, motion.angle + motion.angleAmplitude*displacement
+}
+
+type rotationMotion struct {
+	positionX float64
+	positionY float64
+	angle     float64
+
+	angularVelocity float64
+}
+
+func (motion *rotationMotion) pose(simulatedTime float64) (float64, float64, float64) {
+	return motion.positionX, motion.positionY, motion.angle + motion.angularVelocity*simulatedTime
+}
+
+type keyframeMotion struct {
+	keyframes []config.KeyframeConfig
+	loop      bool
+}
+
+func (motion *keyframeMotion) pose(simulatedTime float64) (float64, float64, float64) {
+	firstKeyframe := motion.keyframes[0]
+	lastKeyframe := motion.keyframes[len(motion.keyframes)-1]
+	if motion.loop && lastKeyframe.Time > firstKeyframe.Time && simulatedTime > lastKeyframe.Time {
+		simulatedTime = firstKeyframe.Time + math.Mod(simulatedTime-firstKeyframe.Time, lastKeyframe.Time-firstKeyframe.Time)
+	}
+
+	if simulatedTime <= firstKeyframe.Time {
+		return firstKeyframe.PositionX, firstKeyframe.PositionY, firstKeyframe.Angle
+	}
+	for keyframeIndex := 1; keyframeIndex < len(motion.keyframes); keyframeIndex += 1 {
+		startKeyframe := motion.keyframes[keyframeIndex-1]
+		endKeyframe := motion.keyframes[keyframeIndex]
+		if simulatedTime > endKeyframe.Time {
+			continue
+		}
+		t := (simulatedTime - startKeyframe.Time) / (endKeyframe.Time - startKeyframe.Time)
+		return startKeyframe.PositionX + t*(endKeyframe.PositionX-startKeyframe.PositionX),
+			startKeyframe.PositionY + t*(endKeyframe.PositionY-startKeyframe.PositionY),
+			startKeyframe.Angle + t*(endKeyframe.Angle-startKeyframe.Angle)
+	}
+	return lastKeyframe.PositionX, lastKeyframe.PositionY, lastKeyframe.Angle
+}
@@ -7,14 +7,36 @@ import (
 const (
 	xDIR int = 0
 	yDIR int = 1
+	zDIR int = 2
 )
 
 type Particle struct {
+	// The position and velocity at which forces are evaluated.
+	//
+	// Integrators set these to whatever intermediate state they require
+	// before calculating the accelerations of the particles.
 	PredictedPosition *mat.VecDense
-	Position          *mat.VecDense
-	Velocity          *mat.VecDense
+	PredictedVelocity *mat.VecDense
+
+	Position *mat.VecDense
+	Velocity *mat.VecDense
+
+	// The index of the phase of this particle in the SimulationConfig
+	Phase int
+
+	Temperature float64
+
+	// The deviatoric stress of the particle, if it is of an elastoplastic solid phase.
+	// Entries past the number of dimensions are always zero
+	deviatoricStress [3][3]float64
 }
 
 func (p *Particle) updatePredictedPosition(stepSize float64) {
 	p.PredictedPosition.AddScaledVec(p.Position, stepSize, p.Velocity)
 }
+
+// Set the predicted state of the particle to exactly the current state
+func (p *Particle) resetPredictedState() {
+	p.PredictedPosition.CopyVec(p.Position)
+	p.PredictedVelocity.CopyVec(p.Velocity)
+}
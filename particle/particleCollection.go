@@ -2,6 +2,9 @@ package particle
 
 import (
 	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+	"slices"
 	"sync"
 
 	"golang.org/x/exp/rand"
@@ -9,49 +12,282 @@ import (
 )
 
 type ParticleCollection struct {
+	// The number of dimensions of the simulation, and so the length of every position and velocity
+	dimensions int
+
+	// The random number generator used while placing and emitting particles, which only happens outside the
+	// worker threads. Worker threads use particleRandomFloat instead, so the result does not depend on the
+	// number of worker threads
 	rng              *rand.Rand
 	simulationConfig *config.SimulationConfig
 	spatialHashing   *spatialHashingStructure
-	smoothingKernel  *smoothingKernelStructure
+	densityKernel    SmoothingKernel
+	pressureKernel   SmoothingKernel
+	viscosityKernel  SmoothingKernel
+	equationOfState  EquationOfState
+	solver           Solver
 	Particles        []*Particle
 	densities        []float64
+
+	RigidBodies []*RigidBody
+	Obstacles   []*Obstacle
+
+	// The emitters that add particles. Set if particles have been added or removed during the current step,
+	// so that anything remembered about the particles from previous steps can be discarded
+	emitters         []*emitter
+	particlesChanged bool
+
+	// The boundary particles, their volumes, and the spatial hashing of their positions, used when the BoundaryMode
+	// is "BoundaryParticles" or there are rigid bodies. The boundary particles of the rigid bodies come last, from rigidBodyBoundaryStart.
+	// The pressure term of each particle against the boundary over the most recent step is kept to find the force on each rigid body
+	boundaryParticles      []*Particle
+	boundaryVolumes        []float64
+	boundarySpatialHashing *spatialHashingStructure
+	rigidBodyBoundaryStart int
+	boundaryPressureTerms  []float64
+
+	// The near densities of each particle, used for double density relaxation (Clavet et al. 2005).
+	// The near density kernel is spikier than the density kernel, so the resulting near pressure
+	// acts as a short range repulsion that prevents particles from clustering
+	nearDensityKernel SmoothingKernel
+	nearDensities     []float64
+
+	// The cohesion kernel and surface normals of each particle, used for surface tension
+	cohesionKernel SmoothingKernel
+	surfaceNormals []*mat.VecDense
+
+	// How the direction of gravity turns over time, if at all, and the tilt added from outside the simulation.
+	// Set if gravity is a force per unit volume rather than an acceleration
+	gravityMotion    obstacleMotion
+	gravityTilt      float64
+	gravityPerVolume bool
+
+	// The external force fields acting on the particles, in addition to gravity
+	forceFields []*forceField
+
+	// The point particles are pulled towards (or pushed away from, if the strength is negative) from outside
+	// the simulation, e.g. by the mouse. There is no interaction while the strength is zero
+	interactionX        float64
+	interactionY        float64
+	interactionStrength float64
+
+	// The heat sources, and the rate of change of temperature of each particle due to conduction
+	heatSources      []*heatSource
+	temperatureRates []float64
+
+	// The viscosity model of each phase, and the viscosity of each particle at the current shear rate.
+	// Only calculated if some phase is not Newtonian
+	viscosityModels []ViscosityModel
+	viscosities     []float64
+	nonNewtonian    bool
+
+	// The artificial stress of each particle, and the kernel value at the rest spacing of each phase.
+	// Only calculated if some phase is an elastoplastic solid. The kernel value is zero if the
+	// SmoothingKernelRadius does not reach the rest spacing, in which case there is no artificial stress
+	artificialStresses         [][3][3]float64
+	artificialStressReferences []float64
+	elastoplastic              bool
+
+	// The vorticity of each particle, as three components even in two dimensions.
+	// Only calculated if vorticity confinement is enabled or particles are colored by vorticity
+	vorticities      [][3]float64
+	vorticityEnabled bool
+
+	// The accelerations of each particle, evaluated at the predicted state
+	// during the most recent call to calculateAccelerations
+	accelerations []*mat.VecDense
+
+	// The step size of the most recent step, the total time simulated so far, and the number of steps taken
+	currentStepSize float64
+	simulatedTime   float64
+	stepCount       uint64
+
+	solverStatistics SolverStatistics
 }
 
 func CreateParticleCollection(simulationConfig *config.SimulationConfig) *ParticleCollection {
 	particleCollection := &ParticleCollection{}
 	particleCollection.simulationConfig = simulationConfig
-	particleCollection.Particles = make([]*Particle, simulationConfig.NumParticles)
+	particleCollection.Particles = make([]*Particle, 0, simulationConfig.NumParticles)
+
+	particleCollection.dimensions = simulationConfig.Dimensions
+	switch particleCollection.dimensions {
+	case 2:
+	case 3:
+		if len(simulationConfig.Obstacles) > 0 || len(simulationConfig.RigidBodies) > 0 || simulationConfig.BoundaryMode != "Reflect" {
+			log.Panicf("obstacles, rigid bodies, and boundary particles are only supported in two dimensions")
+		}
+	default:
+		log.Panicf("unsupported number of dimensions %v", simulationConfig.Dimensions)
+	}
 
 	particleCollection.rng = rand.New(rand.NewSource(simulationConfig.RandomSeed))
 	particleCollection.spatialHashing = createSpatialHashingStructure(
 		2*simulationConfig.SmoothingKernelRadius,
 		particleCollection.simulationConfig.SpatialHashingBins,
 		simulationConfig.NumParticles,
-		simulationConfig.SimulationWidth,
-		simulationConfig.SimulationHeight,
+		particleCollection.simulationSizes(),
+		particleCollection.periodicAxes(),
 	)
 
-	particleCollection.smoothingKernel = newSmoothingKernel(simulationConfig.SmoothingKernelRadius)
+	particleCollection.densityKernel = newSmoothingKernel(simulationConfig.DensityKernel, simulationConfig.SmoothingKernelRadius, simulationConfig.PowerKernelExponent, particleCollection.dimensions)
+	particleCollection.pressureKernel = newSmoothingKernel(simulationConfig.PressureKernel, simulationConfig.SmoothingKernelRadius, simulationConfig.PowerKernelExponent, particleCollection.dimensions)
+	particleCollection.viscosityKernel = newSmoothingKernel(simulationConfig.ViscosityKernel, simulationConfig.SmoothingKernelRadius, simulationConfig.PowerKernelExponent, particleCollection.dimensions)
+	particleCollection.nearDensityKernel = newSpikyKernel(simulationConfig.SmoothingKernelRadius, particleCollection.dimensions)
+	particleCollection.cohesionKernel = newCohesionKernel(simulationConfig.SmoothingKernelRadius, particleCollection.dimensions)
+	particleCollection.equationOfState = newEquationOfState(
+		simulationConfig.EquationOfState,
+		simulationConfig.PressureCoefficient,
+		simulationConfig.SpeedOfSound,
+		simulationConfig.TaitGamma,
+	)
+	particleCollection.solver = newSolver(simulationConfig)
+	particleCollection.vorticityEnabled = simulationConfig.VorticityConfinementCoefficient != 0 || simulationConfig.ColorMode == "Vorticity"
+	for _, phase := range simulationConfig.Phases {
+		particleCollection.viscosityModels = append(particleCollection.viscosityModels, newViscosityModel(phase))
+		particleCollection.nonNewtonian = particleCollection.nonNewtonian || phase.ViscosityModel != "Newtonian"
+		particleCollection.elastoplastic = particleCollection.elastoplastic || phase.ShearModulus != 0
+		restSpacing := math.Pow(phase.ParticleMass/phase.RestDensity, 1/float64(particleCollection.dimensions))
+		particleCollection.artificialStressReferences = append(particleCollection.artificialStressReferences, particleCollection.densityKernel.Value(restSpacing))
+	}
 
-	for particleIndex := 0; particleIndex < simulationConfig.NumParticles; particleIndex += 1 {
-		particleX := float64(simulationConfig.SimulationWidth) * particleCollection.rng.Float64()
-		particleY := float64(simulationConfig.SimulationHeight) * particleCollection.rng.Float64()
-		particleCollection.Particles[particleIndex] = &Particle{
-			PredictedPosition: mat.NewVecDense(2, []float64{particleX, particleY}),
-			Position:          mat.NewVecDense(2, []float64{particleX, particleY}),
-			Velocity:          mat.NewVecDense(2, nil),
-		}
+	for _, rigidBodyConfig := range simulationConfig.RigidBodies {
+		particleCollection.RigidBodies = append(particleCollection.RigidBodies, newRigidBody(rigidBodyConfig))
+	}
+	for _, obstacleConfig := range simulationConfig.Obstacles {
+		particleCollection.Obstacles = append(particleCollection.Obstacles, newObstacle(obstacleConfig))
+	}
+	particleCollection.gravityMotion = newObstacleMotion(simulationConfig.GravityMotion, 0, 0, simulationConfig.GravityAngle)
+	switch simulationConfig.GravityModel {
+	case "ForcePerVolume":
+		particleCollection.gravityPerVolume = true
+	case "Acceleration":
+	default:
+		log.Panicf("unknown gravity model %q", simulationConfig.GravityModel)
+	}
+	for _, forceFieldConfig := range simulationConfig.ForceFields {
+		particleCollection.forceFields = append(particleCollection.forceFields, newForceField(forceFieldConfig))
+	}
+	particleCollection.createBoundaryParticles()
+	for _, emitterConfig := range simulationConfig.Emitters {
+		particleCollection.emitters = append(particleCollection.emitters, newEmitter(emitterConfig, simulationConfig.Phases))
+	}
+	for _, heatSourceConfig := range simulationConfig.HeatSources {
+		particleCollection.heatSources = append(particleCollection.heatSources, newHeatSource(heatSourceConfig, simulationConfig))
 	}
 
-	particleCollection.densities = make([]float64, simulationConfig.NumParticles)
+	for phaseIndex, phase := range simulationConfig.Phases {
+		for phaseParticleIndex := 0; phaseParticleIndex < phase.NumParticles; phaseParticleIndex += 1 {
+			particleX, particleY := particleCollection.randomPositionInRegions(phase.Regions)
+			position := []float64{particleX, particleY}
+			if particleCollection.dimensions == 3 {
+				position = append(position, float64(simulationConfig.SimulationDepth)*particleCollection.rng.Float64())
+			}
+			particleCollection.addParticle(particleCollection.newParticle(position, phaseIndex))
+		}
+	}
 
 	return particleCollection
 }
 
+// Create a vector with one entry per dimension of the simulation
+func (particleCollection *ParticleCollection) newVector() *mat.VecDense {
+	return mat.NewVecDense(particleCollection.dimensions, nil)
+}
+
+// Create a stationary particle of the given phase at the given position, which must have one entry per dimension.
+// The particle starts at the temperature of its phase
+func (particleCollection *ParticleCollection) newParticle(position []float64, phaseIndex int) *Particle {
+	return &Particle{
+		PredictedPosition: mat.NewVecDense(particleCollection.dimensions, slices.Clone(position)),
+		PredictedVelocity: particleCollection.newVector(),
+		Position:          mat.NewVecDense(particleCollection.dimensions, position),
+		Velocity:          particleCollection.newVector(),
+		Phase:             phaseIndex,
+		Temperature:       particleCollection.simulationConfig.Phases[phaseIndex].Temperature,
+	}
+}
+
+// Pick a uniformly random position over the total area of the given regions, outside of any obstacles or rigid bodies.
+//
+// If no such position is found after maxPlacementAttempts, the last position tried is used anyway.
+func (particleCollection *ParticleCollection) randomPositionInRegions(regions []config.RegionConfig) (float64, float64) {
+	const maxPlacementAttempts = 100
+
+	var particleX, particleY float64
+	for attempt := 0; attempt < maxPlacementAttempts; attempt += 1 {
+		particleX, particleY = particleCollection.randomPositionInAnyRegion(regions)
+		if !particleCollection.isInsideSolid(particleX, particleY) {
+			break
+		}
+	}
+	return particleX, particleY
+}
+
+// Check if a position is inside any obstacle or rigid body
+func (particleCollection *ParticleCollection) isInsideSolid(x float64, y float64) bool {
+	for _, obstacle := range particleCollection.Obstacles {
+		if distance, _, _ := obstacle.signedDistance(x, y); distance < 0 {
+			return true
+		}
+	}
+	for _, body := range particleCollection.RigidBodies {
+		if distance, _, _ := body.signedDistance(x, y); distance < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick a uniformly random position over the total area of the given regions
+func (particleCollection *ParticleCollection) randomPositionInAnyRegion(regions []config.RegionConfig) (float64, float64) {
+	region := regions[0]
+	if len(regions) > 1 {
+		totalArea := 0.0
+		for _, candidateRegion := range regions {
+			totalArea += candidateRegion.Area()
+		}
+
+		remainingArea := totalArea * particleCollection.rng.Float64()
+		for _, candidateRegion := range regions {
+			region = candidateRegion
+			remainingArea -= candidateRegion.Area()
+			if remainingArea < 0 {
+				break
+			}
+		}
+	}
+
+	particleX := region.MinX + (region.MaxX-region.MinX)*particleCollection.rng.Float64()
+	particleY := region.MinY + (region.MaxY-region.MinY)*particleCollection.rng.Float64()
+	return particleX, particleY
+}
+
+// Get the phase of the particle with the given index
+func (particleCollection *ParticleCollection) particlePhase(particleIndex int) *config.PhaseConfig {
+	return &particleCollection.simulationConfig.Phases[particleCollection.Particles[particleIndex].Phase]
+}
+
+// Get a value in [-1, 1] for each particle, used to color the particles.
+//
+// If the ColorMode is "Phase" the particles are instead colored by phase, so this returns nil.
 func (particleCollection *ParticleCollection) GetParticleColors() []float64 {
+	switch particleCollection.simulationConfig.ColorMode {
+	case "Density":
+	case "Temperature":
+		return particleCollection.getTemperatureColors()
+	case "Vorticity":
+		return particleCollection.getVorticityColors()
+	case "Phase":
+		return nil
+	default:
+		log.Panicf("unknown color mode %q", particleCollection.simulationConfig.ColorMode)
+	}
+
 	particleColorMap := make([]float64, len(particleCollection.Particles))
 	for particleIndex := 0; particleIndex < len(particleCollection.Particles); particleIndex += 1 {
-		currentColorMap := (particleCollection.densities[particleIndex] - particleCollection.simulationConfig.FluidTargetDensity) / particleCollection.simulationConfig.FluidTargetDensity
+		restDensity := particleCollection.particlePhase(particleIndex).RestDensity
+		currentColorMap := (particleCollection.densities[particleIndex] - restDensity) / restDensity
 		currentColorMap = min(currentColorMap, 1)
 		currentColorMap = max(currentColorMap, -1)
 		particleColorMap[particleIndex] = currentColorMap
@@ -68,42 +304,152 @@ func (particleCollection *ParticleCollection) GetParticleColors() []float64 {
 	return particleColorMap
 }
 
+// Get the temperature of each particle relative to the ReferenceTemperature, scaled to [-1, 1]
+// by the largest temperature difference of any phase or heat source
+func (particleCollection *ParticleCollection) getTemperatureColors() []float64 {
+	referenceTemperature := particleCollection.simulationConfig.ReferenceTemperature
+	temperatureScale := particleCollection.temperatureColorScale()
+
+	particleColorMap := make([]float64, len(particleCollection.Particles))
+	for particleIndex, p := range particleCollection.Particles {
+		currentColorMap := (p.Temperature - referenceTemperature) / temperatureScale
+		particleColorMap[particleIndex] = min(max(currentColorMap, -1), 1)
+	}
+	return particleColorMap
+}
+
+// Get the total kinetic energy of all particles, using the current velocities
+func (particleCollection *ParticleCollection) KineticEnergy() float64 {
+	kineticEnergy := 0.0
+	for particleIndex, p := range particleCollection.Particles {
+		kineticEnergy += 0.5 * particleCollection.particlePhase(particleIndex).ParticleMass * mat.Dot(p.Velocity, p.Velocity)
+	}
+	return kineticEnergy
+}
+
+// Get the total gravitational potential energy of all particles under the current gravity, taking the top left corner of the simulation as zero.
+// If gravity is a force per unit volume the density of each particle from the most recent step is used, so this is only conserved while the densities are constant.
+//
+// Remember - y axis starts with 0 at the top and increases *downwards*, so while gravity points straight down this is never positive
+func (particleCollection *ParticleCollection) GravitationalPotentialEnergy() float64 {
+	potentialEnergy := 0.0
+	for particleIndex, p := range particleCollection.Particles {
+		gravityX, gravityY := particleCollection.gravityAcceleration(particleCollection.densities[particleIndex])
+		potentialEnergy -= particleCollection.particlePhase(particleIndex).ParticleMass * (gravityX*p.Position.AtVec(xDIR) + gravityY*p.Position.AtVec(yDIR))
+	}
+	return potentialEnergy
+}
+
+// Calculate the density and near density of each particle at the predicted positions.
+//
+// Following Solenthaler and Pajarola (2008), the density is the mass of the particle itself multiplied by the
+// number density Σ W_ij, rather than Σ m_j W_ij. This keeps the density of each phase close to its own rest density
+// at an interface between phases, instead of smoothing the density across the interface.
 func (particleCollection *ParticleCollection) calculateDensityWorker(particleIndexChannel <-chan int) {
-	displacementVec := mat.NewVecDense(2, nil)
+	displacementVec := particleCollection.newVector()
 	for particleIndex := range particleIndexChannel {
 		density := 0.0
+		nearDensity := 0.0
+		particleMass := particleCollection.particlePhase(particleIndex).ParticleMass
 
 		targetParticle := particleCollection.Particles[particleIndex]
 		neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
 		for _, neighborIndex := range neighboringParticleIndices {
-			displacementVec.SubVec(targetParticle.PredictedPosition, particleCollection.Particles[neighborIndex].PredictedPosition)
+			particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, particleCollection.Particles[neighborIndex].PredictedPosition)
 			displacementMagnitude := displacementVec.Norm(2)
-			influence := particleCollection.smoothingKernel.kernel(displacementMagnitude)
-			density += particleCollection.simulationConfig.ParticleMass * influence
+			influence := particleCollection.densityKernel.Value(displacementMagnitude)
+			density += particleMass * influence
+			nearInfluence := particleCollection.nearDensityKernel.Value(displacementMagnitude)
+			nearDensity += particleMass * nearInfluence
+		}
+		for _, boundaryIndex := range particleCollection.getNeighboringBoundaryIndices(targetParticle) {
+			particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, particleCollection.boundaryParticles[boundaryIndex].Position)
+			density += particleCollection.boundaryMass(particleIndex, boundaryIndex) * particleCollection.densityKernel.Value(displacementVec.Norm(2))
 		}
 		particleCollection.densities[particleIndex] = density
+		particleCollection.nearDensities[particleIndex] = nearDensity
+	}
+}
+
+// The average of the pressures of two particles, each relative to the rest density of its own phase
+func (particleCollection *ParticleCollection) calculateSharedPressure(particleIndexA int, particleIndexB int) float64 {
+	pressureA := particleCollection.equationOfState.Pressure(particleCollection.densities[particleIndexA], particleCollection.particlePhase(particleIndexA).RestDensity)
+	pressureB := particleCollection.equationOfState.Pressure(particleCollection.densities[particleIndexB], particleCollection.particlePhase(particleIndexB).RestDensity)
+	return (pressureA + pressureB) / 2
+}
+
+// Near pressure has no target density, so it is purely repulsive
+func (particleCollection *ParticleCollection) calculateSharedNearPressure(nearDensityA float64, nearDensityB float64) float64 {
+	return particleCollection.simulationConfig.NearPressureCoefficient * (nearDensityA + nearDensityB) / 2
+}
+
+// Calculate the gradient of the pressure kernel between two particles at their predicted positions,
+// ∇W_ij, storing the result in gradientVec.
+//
+// Returns false if the particles are coincident, in which case the gradient is undefined.
+func (particleCollection *ParticleCollection) calculatePressureKernelGradient(gradientVec *mat.VecDense, particleIndex int, neighborIndex int) bool {
+	particleCollection.calculateDisplacement(gradientVec, particleCollection.Particles[particleIndex].PredictedPosition, particleCollection.Particles[neighborIndex].PredictedPosition)
+	displacementMagnitude := gradientVec.Norm(2)
+	if displacementMagnitude == 0 {
+		return false
+	}
+
+	gradientVec.ScaleVec(particleCollection.pressureKernel.Gradient(displacementMagnitude)/displacementMagnitude, gradientVec)
+	return true
+}
+
+// Calculate the velocity gradient of a particle at the predicted state, ∇v_i = Σ (m_j / ρ_j) (v_j - v_i) ⊗ ∇W_ij,
+// where entry [a][b] is the derivative of velocity component a along axis b. Entries past the number of dimensions are zero.
+func (particleCollection *ParticleCollection) calculateVelocityGradient(particleIndex int, gradientVec *mat.VecDense, velocityDifferential *mat.VecDense) [3][3]float64 {
+	targetParticle := particleCollection.Particles[particleIndex]
+	var velocityGradient [3][3]float64
+
+	neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+	for _, neighborIndex := range neighboringParticleIndices {
+		if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+			continue
+		}
+
+		neighborVolume := particleCollection.particlePhase(neighborIndex).ParticleMass / particleCollection.densities[neighborIndex]
+		velocityDifferential.SubVec(particleCollection.Particles[neighborIndex].PredictedVelocity, targetParticle.PredictedVelocity)
+		for row := 0; row < particleCollection.dimensions; row += 1 {
+			for column := 0; column < particleCollection.dimensions; column += 1 {
+				velocityGradient[row][column] += neighborVolume * velocityDifferential.AtVec(row) * gradientVec.AtVec(column)
+			}
+		}
 	}
+	return velocityGradient
 }
 
-func (particleCollection *ParticleCollection) calculateSharedPressure(densityA float64, densityB float64) float64 {
-	pressureA := densityA - particleCollection.simulationConfig.FluidTargetDensity
-	pressureB := densityB - particleCollection.simulationConfig.FluidTargetDensity
-	return particleCollection.simulationConfig.PressureCoefficient * (pressureA + pressureB) / 2
+// Calculate the acceleration of each particle at the predicted state, storing the result in particleCollection.accelerations
+func (particleCollection *ParticleCollection) calculateAccelerationWorker(particleIndexChannel <-chan int) {
+	particleCollection.accelerationWorker(particleIndexChannel, true)
 }
 
-func (particleCollection *ParticleCollection) tickParticleWorker(particleIndexChannel <-chan int) {
-	totalForce := mat.NewVecDense(2, nil)
+// Calculate the acceleration of each particle at the predicted state, excluding pressure,
+// storing the result in particleCollection.accelerations.
+//
+// This is used by the solvers that calculate the pressure themselves.
+func (particleCollection *ParticleCollection) calculateNonPressureAccelerationWorker(particleIndexChannel <-chan int) {
+	particleCollection.accelerationWorker(particleIndexChannel, false)
+}
+
+func (particleCollection *ParticleCollection) accelerationWorker(particleIndexChannel <-chan int, includePressure bool) {
+	totalForce := particleCollection.newVector()
+	surfaceTensionAcceleration := particleCollection.newVector()
+	stressAcceleration := particleCollection.newVector()
+	displacementVec := particleCollection.newVector()
+	velocityDifferential := particleCollection.newVector()
+	gradientVec := particleCollection.newVector()
 	for particleIndex := range particleIndexChannel {
 		targetParticle := particleCollection.Particles[particleIndex]
-
-		// Remember - y axis starts with 0 at the top and increases *downwards*
+		targetPhase := particleCollection.particlePhase(particleIndex)
 		totalForce.Zero()
-		totalForce.SetVec(yDIR, particleCollection.simulationConfig.GravityStrength)
+		surfaceTensionAcceleration.Zero()
+		stressAcceleration.Zero()
 
 		neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
 		// Calculate influence due to neighboring particles
-		displacementVec := mat.NewVecDense(2, nil)
-		velocityDifferential := mat.NewVecDense(2, nil)
 		for _, neighborIndex := range neighboringParticleIndices {
 			if particleIndex == neighborIndex {
 				continue
@@ -111,77 +457,195 @@ func (particleCollection *ParticleCollection) tickParticleWorker(particleIndexCh
 
 			// Get neighboring particle, find distance to that neighbor
 			neighborParticle := particleCollection.Particles[neighborIndex]
-			displacementVec.SubVec(targetParticle.PredictedPosition, neighborParticle.PredictedPosition)
+			neighborPhase := particleCollection.particlePhase(neighborIndex)
+			particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, neighborParticle.PredictedPosition)
 			displacementMagnitude := displacementVec.Norm(2)
 
-			// Convert displacement to direction by scaling to unit vector
-			displacementVec.ScaleVec(1/displacementMagnitude, displacementVec)
+			// Convert displacement to direction by scaling to unit vector.
+			// Coincident particles have no direction, so pick one based on the particle ordering
+			if displacementMagnitude == 0 {
+				displacementVec.Zero()
+				if particleIndex < neighborIndex {
+					displacementVec.SetVec(xDIR, -1)
+				} else {
+					displacementVec.SetVec(xDIR, 1)
+				}
+			} else {
+				displacementVec.ScaleVec(1/displacementMagnitude, displacementVec)
+			}
 
-			// Get magnitude of gradient at this displacement
-			gradientMagnitude := particleCollection.smoothingKernel.kernelGradientMagnitude(displacementMagnitude)
+			if includePressure {
+				// Get magnitude of gradient at this displacement
+				gradientMagnitude := -particleCollection.pressureKernel.Gradient(displacementMagnitude)
 
-			// Find average pressure between the two particles and use this (approximating newtons third law)
-			sharedPressure := particleCollection.calculateSharedPressure(particleCollection.densities[particleIndex], particleCollection.densities[neighborIndex])
-			pressureContributionMagnitude := sharedPressure * gradientMagnitude * particleCollection.simulationConfig.ParticleMass / particleCollection.densities[neighborIndex]
-			totalForce.AddScaledVec(totalForce, pressureContributionMagnitude, displacementVec)
+				// Find average pressure between the two particles and use this (approximating newtons third law)
+				sharedPressure := particleCollection.calculateSharedPressure(particleIndex, neighborIndex)
+				pressureContributionMagnitude := sharedPressure * gradientMagnitude * neighborPhase.ParticleMass / particleCollection.densities[neighborIndex]
+				totalForce.AddScaledVec(totalForce, pressureContributionMagnitude, displacementVec)
+			}
 
-			// Calculate viscosity force
-			velocityDifferential.SubVec(targetParticle.Velocity, neighborParticle.Velocity)
-			influence := -particleCollection.smoothingKernel.kernel(displacementMagnitude)
-			totalForce.AddScaledVec(totalForce, influence*particleCollection.simulationConfig.ViscosityCoefficient, velocityDifferential)
+			// Near pressure uses the same approximation, but with the near density kernel. It is a short range repulsion
+			// rather than part of the pressure, so it is included for the solvers that calculate the pressure themselves
+			if particleCollection.simulationConfig.NearPressureCoefficient != 0 {
+				nearGradientMagnitude := -particleCollection.nearDensityKernel.Gradient(displacementMagnitude)
+				sharedNearPressure := particleCollection.calculateSharedNearPressure(particleCollection.nearDensities[particleIndex], particleCollection.nearDensities[neighborIndex])
+				nearPressureContributionMagnitude := sharedNearPressure * nearGradientMagnitude * neighborPhase.ParticleMass / particleCollection.nearDensities[neighborIndex]
+				totalForce.AddScaledVec(totalForce, nearPressureContributionMagnitude, displacementVec)
+			}
+
+			// Calculate viscosity force from the Laplacian of the velocity (Müller et al. 2003), using the average viscosity of the two particles.
+			// Coincident particles are skipped if the Laplacian is singular at zero distance
+			viscosityLaplacian := particleCollection.viscosityKernel.Laplacian(displacementMagnitude)
+			if !math.IsInf(viscosityLaplacian, 0) {
+				velocityDifferential.SubVec(targetParticle.PredictedVelocity, neighborParticle.PredictedVelocity)
+				influence := -viscosityLaplacian * neighborPhase.ParticleMass / particleCollection.densities[neighborIndex]
+				sharedViscosity := (particleCollection.particleViscosity(particleIndex) + particleCollection.particleViscosity(neighborIndex)) / 2
+				totalForce.AddScaledVec(totalForce, influence*sharedViscosity, velocityDifferential)
+			}
+
+			// Calculate surface tension, which is already an acceleration rather than a force density
+			if particleCollection.simulationConfig.SurfaceTensionCoefficient != 0 {
+				particleCollection.addSurfaceTensionAcceleration(surfaceTensionAcceleration, particleIndex, neighborIndex, displacementVec, displacementMagnitude)
+			}
+
+			// Calculate the acceleration due to the deviatoric stress of elastoplastic solids, which is also already an acceleration.
+			// Fluid particles have no stress, so pairs of fluid particles are skipped
+			if particleCollection.elastoplastic && (targetPhase.ShearModulus != 0 || neighborPhase.ShearModulus != 0) {
+				particleCollection.addStressAcceleration(stressAcceleration, particleIndex, neighborIndex, displacementVec, displacementMagnitude)
+			}
 		}
-		targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, particleCollection.simulationConfig.SimulationStepSize/particleCollection.densities[particleIndex], totalForce)
-		targetParticle.Position.AddScaledVec(targetParticle.Position, particleCollection.simulationConfig.SimulationStepSize, targetParticle.Velocity)
 
-		// Handle edge of simulation
-		if targetParticle.Position.AtVec(xDIR) <= 0.0 {
-			targetParticle.Position.SetVec(xDIR, particleCollection.rng.Float64())
-			targetParticle.Velocity.SetVec(xDIR, -targetParticle.Velocity.AtVec(xDIR)*particleCollection.simulationConfig.CollisionDampingCoefficient)
-		} else if targetParticle.Position.AtVec(xDIR) >= float64(particleCollection.simulationConfig.SimulationWidth) {
-			targetParticle.Position.SetVec(xDIR, float64(particleCollection.simulationConfig.SimulationWidth)-particleCollection.rng.Float64())
-			targetParticle.Velocity.SetVec(xDIR, -targetParticle.Velocity.AtVec(xDIR)*particleCollection.simulationConfig.CollisionDampingCoefficient)
+		particleCollection.addRigidBodyViscousForce(totalForce, particleIndex, displacementVec, velocityDifferential)
+
+		acceleration := particleCollection.accelerations[particleIndex]
+		acceleration.ScaleVec(1/particleCollection.densities[particleIndex], totalForce)
+		acceleration.AddVec(acceleration, surfaceTensionAcceleration)
+		acceleration.AddVec(acceleration, stressAcceleration)
+		if particleCollection.simulationConfig.VorticityConfinementCoefficient != 0 {
+			particleCollection.addVorticityConfinementAcceleration(acceleration, particleIndex, gradientVec)
 		}
-		if targetParticle.Position.AtVec(yDIR) <= 0.0 {
-			targetParticle.Position.SetVec(yDIR, particleCollection.rng.Float64())
-			targetParticle.Velocity.SetVec(yDIR, -targetParticle.Velocity.AtVec(yDIR)*particleCollection.simulationConfig.CollisionDampingCoefficient)
-		} else if targetParticle.Position.AtVec(yDIR) >= float64(particleCollection.simulationConfig.SimulationHeight) {
-			targetParticle.Position.SetVec(yDIR, float64(particleCollection.simulationConfig.SimulationHeight)-particleCollection.rng.Float64())
-			targetParticle.Velocity.SetVec(yDIR, -targetParticle.Velocity.AtVec(yDIR)*particleCollection.simulationConfig.CollisionDampingCoefficient)
+
+		// The boundary only ever pushes particles away, so negative pressures are ignored
+		if includePressure {
+			density := particleCollection.densities[particleIndex]
+			pressure := max(particleCollection.equationOfState.Pressure(density, targetPhase.RestDensity), 0)
+			particleCollection.boundaryPressureTerms[particleIndex] = pressure / (density * density)
+			particleCollection.addBoundaryPressureAcceleration(acceleration, particleIndex, particleCollection.boundaryPressureTerms[particleIndex])
 		}
+
+		// Gravity is scaled by the Boussinesq buoyancy due to temperature
+		gravityX, gravityY := particleCollection.gravityAcceleration(particleCollection.densities[particleIndex])
+		buoyancyScale := particleCollection.buoyancyScale(targetParticle)
+		acceleration.SetVec(xDIR, acceleration.AtVec(xDIR)+gravityX*buoyancyScale)
+		acceleration.SetVec(yDIR, acceleration.AtVec(yDIR)+gravityY*buoyancyScale)
+		particleCollection.addForceFieldAccelerations(acceleration, targetParticle)
 	}
 }
 
-func (particleCollection *ParticleCollection) TickParticles() {
-	var workerThreadWaitGroup sync.WaitGroup
-	var particleIndexChannel chan int
+// Update the densities and accelerations of all particles using the predicted state of each particle
+func (particleCollection *ParticleCollection) calculateAccelerations() {
+	particleCollection.updateNeighborhoods()
+	particleCollection.runParticleWorkers(particleCollection.calculateAccelerationWorker)
+}
 
-	for _, p := range particleCollection.Particles {
-		p.updatePredictedPosition(particleCollection.simulationConfig.SimulationStepSize)
-	}
+// Update the densities and all accelerations other than pressure using the predicted state of each particle
+func (particleCollection *ParticleCollection) calculateNonPressureAccelerations() {
+	particleCollection.updateNeighborhoods()
+	particleCollection.runParticleWorkers(particleCollection.calculateNonPressureAccelerationWorker)
+}
 
+// Rehash the particles at their predicted positions, and recalculate all quantities
+// that depend only on the particle neighborhoods (e.g. densities)
+func (particleCollection *ParticleCollection) updateNeighborhoods() {
 	particleCollection.spatialHashing.updateSpatialHashing(particleCollection.Particles)
+	particleCollection.runParticleWorkers(particleCollection.calculateDensityWorker)
+	if particleCollection.simulationConfig.SurfaceTensionCoefficient != 0 {
+		particleCollection.runParticleWorkers(particleCollection.calculateSurfaceNormalWorker)
+	}
+	if particleCollection.nonNewtonian {
+		particleCollection.runParticleWorkers(particleCollection.calculateViscosityWorker)
+	}
+	if particleCollection.elastoplastic {
+		particleCollection.runParticleWorkers(particleCollection.calculateArtificialStressWorker)
+	}
+	if particleCollection.vorticityEnabled {
+		particleCollection.runParticleWorkers(particleCollection.calculateVorticityWorker)
+	}
+}
 
-	// Recalculate Density Array
-	particleIndexChannel = make(chan int, 10)
-	for workerThreadIndex := 0; workerThreadIndex < particleCollection.simulationConfig.SimulationNumWorkerThreads; workerThreadIndex++ {
-		workerThreadWaitGroup.Add(1)
-		go func() {
-			particleCollection.calculateDensityWorker(particleIndexChannel)
-			workerThreadWaitGroup.Done()
-		}()
+// Keep a particle inside the simulation by reflecting it off the obstacles and the edges of the simulation.
+//
+// With boundary particles the boundary pressure should keep particles from reaching the edges, so any that do are
+// placed exactly on the edge. Otherwise, particles are placed a random distance inside the edge.
+// Along periodic axes particles are instead wrapped around to the opposite edge.
+func (particleCollection *ParticleCollection) handleSimulationEdges(particleIndex int) {
+	targetParticle := particleCollection.Particles[particleIndex]
+	particleCollection.handleObstacleCollisions(targetParticle)
+	particleCollection.wrapPeriodicPosition(targetParticle.Position)
+	if particleCollection.simulationConfig.BoundaryMode == "BoundaryParticles" {
+		particleCollection.reflectOffSimulationEdges(targetParticle)
+		return
 	}
-	for particleIndex := 0; particleIndex < len(particleCollection.Particles); particleIndex += 1 {
-		particleIndexChannel <- particleIndex
+
+	simulationSizes := particleCollection.simulationSizes()
+	for direction, periodic := range particleCollection.periodicAxes() {
+		if periodic {
+			continue
+		}
+		if targetParticle.Position.AtVec(direction) <= 0.0 {
+			targetParticle.Position.SetVec(direction, particleCollection.particleRandomFloat(particleIndex, direction))
+			targetParticle.Velocity.SetVec(direction, -targetParticle.Velocity.AtVec(direction)*particleCollection.simulationConfig.CollisionDampingCoefficient)
+		} else if targetParticle.Position.AtVec(direction) >= simulationSizes[direction] {
+			targetParticle.Position.SetVec(direction, simulationSizes[direction]-particleCollection.particleRandomFloat(particleIndex, direction))
+			targetParticle.Velocity.SetVec(direction, -targetParticle.Velocity.AtVec(direction)*particleCollection.simulationConfig.CollisionDampingCoefficient)
+		}
 	}
-	close(particleIndexChannel)
-	workerThreadWaitGroup.Wait()
+}
 
-	// Tick Particles
-	particleIndexChannel = make(chan int, 10)
+// Place a particle past an edge of the simulation on that edge, reflecting its velocity.
+// Edges along periodic axes are skipped
+func (particleCollection *ParticleCollection) reflectOffSimulationEdges(targetParticle *Particle) {
+	simulationBounds := particleCollection.simulationSizes()
+	for direction, periodic := range particleCollection.periodicAxes() {
+		if periodic {
+			continue
+		}
+		position := targetParticle.Position.AtVec(direction)
+		velocity := targetParticle.Velocity.AtVec(direction)
+		if (position <= 0 && velocity < 0) || (position >= simulationBounds[direction] && velocity > 0) {
+			targetParticle.Velocity.SetVec(direction, -velocity*particleCollection.simulationConfig.CollisionDampingCoefficient)
+		}
+		targetParticle.Position.SetVec(direction, min(max(position, 0), simulationBounds[direction]))
+	}
+}
+
+// Move a (predicted) position out of any obstacles, and then to the nearest point inside the simulation.
+// Along periodic axes the position is wrapped around instead
+func (particleCollection *ParticleCollection) clampToSimulation(position *mat.VecDense) {
+	particleCollection.projectOutOfObstacles(position)
+	particleCollection.wrapPeriodicPosition(position)
+	simulationSizes := particleCollection.simulationSizes()
+	for direction, periodic := range particleCollection.periodicAxes() {
+		if !periodic {
+			position.SetVec(direction, min(max(position.AtVec(direction), 0), simulationSizes[direction]))
+		}
+	}
+}
+
+// Hand every particle index to a pool of worker threads running the given worker function, and wait for all workers to finish.
+//
+// Particles are handed out in no particular order, so for the result to be the same for any number of worker threads
+// a worker may only write the state of the particles it is handed, and may only read the state of other particles
+// that no worker writes during the same run. Workers that need the state of neighboring particles read the predicted
+// state (or some other per particle buffer filled by an earlier run) while writing the current state, or the reverse.
+func (particleCollection *ParticleCollection) runParticleWorkers(worker func(particleIndexChannel <-chan int)) {
+	var workerThreadWaitGroup sync.WaitGroup
+
+	particleIndexChannel := make(chan int, 10)
 	for workerThreadIndex := 0; workerThreadIndex < particleCollection.simulationConfig.SimulationNumWorkerThreads; workerThreadIndex++ {
 		workerThreadWaitGroup.Add(1)
 		go func() {
-			particleCollection.tickParticleWorker(particleIndexChannel)
+			worker(particleIndexChannel)
 			workerThreadWaitGroup.Done()
 		}()
 	}
@@ -192,3 +656,20 @@ func (particleCollection *ParticleCollection) TickParticles() {
 	close(particleIndexChannel)
 	workerThreadWaitGroup.Wait()
 }
+
+func (particleCollection *ParticleCollection) TickParticles() {
+	stepSize := particleCollection.calculateStepSize()
+	particleCollection.removeParticlesInSinks()
+	particleCollection.emitParticles(stepSize)
+	particleCollection.moveObstacles(stepSize)
+	particleCollection.solver.Step(particleCollection, stepSize)
+	particleCollection.applyInteraction(stepSize)
+	particleCollection.updateStresses(stepSize)
+	particleCollection.transferHeat(stepSize)
+	particleCollection.stepRigidBodies(stepSize)
+	particleCollection.particlesChanged = false
+
+	particleCollection.currentStepSize = stepSize
+	particleCollection.simulatedTime += stepSize
+	particleCollection.stepCount += 1
+}
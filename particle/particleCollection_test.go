@@ -0,0 +1,143 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"testing"
+)
+
+// Create a small simulation from the example config, with a fixed RandomSeed
+func createTestParticleCollection(t *testing.T, solver string, integrator string, numWorkerThreads int) *ParticleCollection {
+	t.Helper()
+	simulationConfig, err := config.ReadConfigYaml("../config/exampleConfig.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulationConfig.RandomSeed = 1
+	simulationConfig.Solver = solver
+	simulationConfig.Integrator = integrator
+	simulationConfig.SimulationNumWorkerThreads = numWorkerThreads
+	simulationConfig.NumParticles = 200
+	simulationConfig.Phases[0].NumParticles = 200
+	return CreateParticleCollection(simulationConfig)
+}
+
+// Create a small simulation from the example config with every feature that reads or writes state shared between particles
+// turned on: an elastoplastic phase, emitters and sinks, moving obstacles, heat transfer, and vorticity confinement
+func createFeatureTestParticleCollection(t *testing.T, solver string, integrator string, numWorkerThreads int) *ParticleCollection {
+	t.Helper()
+	simulationConfig, err := config.ReadConfigYaml("../config/exampleConfig.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulationConfig.RandomSeed = 1
+	simulationConfig.Solver = solver
+	simulationConfig.Integrator = integrator
+	simulationConfig.SimulationNumWorkerThreads = numWorkerThreads
+	simulationConfig.NumParticles = 250
+	simulationConfig.Phases[0].NumParticles = 200
+	simulationConfig.Phases[0].ThermalDiffusivity = 0.1
+	jellyPhase := simulationConfig.Phases[0]
+	jellyPhase.Name = "Jelly"
+	jellyPhase.NumParticles = 50
+	jellyPhase.ShearModulus = 0.0001
+	jellyPhase.ElasticLimit = 0.05
+	jellyPhase.Regions = []config.RegionConfig{{MinX: 200, MinY: 100, MaxX: 300, MaxY: 200}}
+	simulationConfig.Phases = append(simulationConfig.Phases, jellyPhase)
+
+	simulationConfig.Emitters = []config.EmitterConfig{{PositionX: 50, PositionY: 50, Width: 20, Direction: 0.5, Speed: 2, Rate: 0.5}}
+	simulationConfig.Sinks = []config.RegionConfig{{MinX: 462, MinY: 462, MaxX: 512, MaxY: 512}}
+	simulationConfig.Obstacles = []config.ObstacleConfig{
+		{ShapeConfig: config.ShapeConfig{Shape: "Circle", Radius: 30}, PositionX: 256, PositionY: 300},
+		{
+			ShapeConfig: config.ShapeConfig{Shape: "Box", Width: 120, Height: 8},
+			PositionX:   256,
+			PositionY:   400,
+			Motion:      config.MotionConfig{Type: "Rotation", AngularVelocity: 0.01},
+		},
+	}
+	simulationConfig.ThermalExpansionCoefficient = 0.01
+	simulationConfig.HeatSources = []config.HeatSourceConfig{{Wall: "Bottom", Temperature: 10, Rate: 0.1}}
+	simulationConfig.VorticityConfinementCoefficient = 0.01
+	simulationConfig.PressureSolverMaxIterations = 10
+	return CreateParticleCollection(simulationConfig)
+}
+
+// A given RandomSeed must give exactly the same simulation for any number of worker threads.
+// Run with -race to also check that the worker threads do not share any state while a step is calculated
+func TestWorkerThreadsDoNotChangeResult(t *testing.T) {
+	const numSteps = 100
+	const numWorkerThreads = 16
+	testCases := []struct {
+		name                     string
+		solver                   string
+		integrator               string
+		createParticleCollection func(t *testing.T, solver string, integrator string, numWorkerThreads int) *ParticleCollection
+	}{
+		{"Explicit/SymplecticEuler", "Explicit", "SymplecticEuler", createTestParticleCollection},
+		{"Explicit/VelocityVerlet", "Explicit", "VelocityVerlet", createTestParticleCollection},
+		{"Explicit/RK4", "Explicit", "RK4", createTestParticleCollection},
+		{"PCISPH/SymplecticEuler", "PCISPH", "SymplecticEuler", createTestParticleCollection},
+		{"DFSPH/SymplecticEuler", "DFSPH", "SymplecticEuler", createTestParticleCollection},
+		{"PBF/SymplecticEuler", "PBF", "SymplecticEuler", createTestParticleCollection},
+		{"Features/Explicit", "Explicit", "VelocityVerlet", createFeatureTestParticleCollection},
+		{"Features/PCISPH", "PCISPH", "SymplecticEuler", createFeatureTestParticleCollection},
+		{"Features/DFSPH", "DFSPH", "SymplecticEuler", createFeatureTestParticleCollection},
+		{"Features/PBF", "PBF", "SymplecticEuler", createFeatureTestParticleCollection},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			singleThreadCollection := testCase.createParticleCollection(t, testCase.solver, testCase.integrator, 1)
+			multiThreadCollection := testCase.createParticleCollection(t, testCase.solver, testCase.integrator, numWorkerThreads)
+			for step := 0; step < numSteps; step += 1 {
+				singleThreadCollection.TickParticles()
+				multiThreadCollection.TickParticles()
+			}
+
+			if len(singleThreadCollection.Particles) != len(multiThreadCollection.Particles) {
+				t.Fatalf("%v particles after %v steps with one worker thread, %v with %v",
+					len(singleThreadCollection.Particles), numSteps, len(multiThreadCollection.Particles), numWorkerThreads)
+			}
+			for particleIndex, singleThreadParticle := range singleThreadCollection.Particles {
+				multiThreadParticle := multiThreadCollection.Particles[particleIndex]
+				for direction := 0; direction < singleThreadParticle.Position.Len(); direction += 1 {
+					if singleThreadParticle.Position.AtVec(direction) != multiThreadParticle.Position.AtVec(direction) {
+						t.Fatalf("particle %v differs after %v steps: %v with one worker thread, %v with %v",
+							particleIndex, numSteps, singleThreadParticle.Position.RawVector().Data, multiThreadParticle.Position.RawVector().Data, numWorkerThreads)
+					}
+				}
+				if singleThreadParticle.Temperature != multiThreadParticle.Temperature {
+					t.Fatalf("particle %v has temperature %v after %v steps with one worker thread, %v with %v",
+						particleIndex, singleThreadParticle.Temperature, numSteps, multiThreadParticle.Temperature, numWorkerThreads)
+				}
+			}
+		})
+	}
+}
+
+// Near pressure must push apart a pair of particles that are much closer than the rest spacing, with every solver
+func TestNearPressureSeparatesClumpedPair(t *testing.T) {
+	const initialSeparation = 1.0
+	for _, solver := range []string{"Explicit", "PCISPH", "DFSPH", "PBF"} {
+		t.Run(solver, func(t *testing.T) {
+			simulationConfig := config.CreateDefaultConfig()
+			simulationConfig.Solver = solver
+			simulationConfig.GravityStrength = 0
+			simulationConfig.PressureCoefficient = 0
+			simulationConfig.NearPressureCoefficient = 0.1
+			simulationConfig.NumParticles = 0
+			simulationConfig.Phases[0].NumParticles = 0
+			particleCollection := CreateParticleCollection(simulationConfig)
+			particleCollection.addParticle(particleCollection.newParticle([]float64{500, 250}, 0))
+			particleCollection.addParticle(particleCollection.newParticle([]float64{500 + initialSeparation, 250}, 0))
+
+			for step := 0; step < 10; step += 1 {
+				particleCollection.TickParticles()
+			}
+			separation := particleCollection.Particles[1].Position.AtVec(xDIR) - particleCollection.Particles[0].Position.AtVec(xDIR)
+			if separation < 2*initialSeparation {
+				t.Errorf("particles are %v apart after 10 steps, starting %v apart", separation, initialSeparation)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package particle
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Position based fluids, following Macklin and Müller (2013).
+//
+// Rather than calculating pressure, the predicted positions of the particles are moved directly so that the density
+// constraint of each particle, ρ_i/ρ_0 - 1 = 0 (with ρ_0 the rest density of its phase), is satisfied. The velocities are then found from the change in position.
+// This is unconditionally stable, but the fluid is only as incompressible as the number of iterations allows.
+type pbfSolver struct {
+	// The scaling factor λ of each particle in the current iteration
+	lambdas []float64
+
+	// The position (or velocity, for XSPH) correction of each particle in the current iteration
+	corrections []*mat.VecDense
+}
+
+func (solver *pbfSolver) Step(particleCollection *ParticleCollection, stepSize float64) {
+	simulationConfig := particleCollection.simulationConfig
+	for len(solver.lambdas) < len(particleCollection.Particles) {
+		solver.lambdas = append(solver.lambdas, 0)
+		solver.corrections = append(solver.corrections, particleCollection.newVector())
+	}
+
+	clear(particleCollection.boundaryPressureTerms)
+
+	// Predict the positions using only the non-pressure accelerations
+	for _, p := range particleCollection.Particles {
+		p.resetPredictedState()
+	}
+	particleCollection.calculateNonPressureAccelerations()
+	for particleIndex, p := range particleCollection.Particles {
+		p.PredictedVelocity.AddScaledVec(p.Velocity, stepSize, particleCollection.accelerations[particleIndex])
+		p.PredictedPosition.AddScaledVec(p.Position, stepSize, p.PredictedVelocity)
+		particleCollection.clampToSimulation(p.PredictedPosition)
+	}
+	particleCollection.spatialHashing.updateSpatialHashing(particleCollection.Particles)
+
+	// The particles are rehashed after every correction, so that the neighborhoods of each
+	// iteration (and of the XSPH viscosity below) match the corrected predicted positions
+	for iteration := 0; iteration < simulationConfig.PBFIterations; iteration += 1 {
+		particleCollection.runParticleWorkers(particleCollection.calculateDensityWorker)
+		particleCollection.runParticleWorkers(solver.calculateLambdaWorker(particleCollection))
+		particleCollection.runParticleWorkers(solver.calculatePositionCorrectionWorker(particleCollection, stepSize))
+		for particleIndex, p := range particleCollection.Particles {
+			p.PredictedPosition.AddVec(p.PredictedPosition, solver.corrections[particleIndex])
+			particleCollection.clampToSimulation(p.PredictedPosition)
+		}
+		particleCollection.spatialHashing.updateSpatialHashing(particleCollection.Particles)
+	}
+
+	// The velocity is the change in position over the step, smoothed by XSPH viscosity
+	for _, p := range particleCollection.Particles {
+		particleCollection.calculateDisplacement(p.PredictedVelocity, p.PredictedPosition, p.Position)
+		p.PredictedVelocity.ScaleVec(1/stepSize, p.PredictedVelocity)
+	}
+	if simulationConfig.XSPHViscosity != 0 {
+		particleCollection.runParticleWorkers(particleCollection.calculateDensityWorker)
+		particleCollection.runParticleWorkers(solver.calculateXSPHCorrectionWorker(particleCollection))
+	}
+
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Velocity.CopyVec(targetParticle.PredictedVelocity)
+			if simulationConfig.XSPHViscosity != 0 {
+				targetParticle.Velocity.AddVec(targetParticle.Velocity, solver.corrections[particleIndex])
+			}
+			targetParticle.Position.CopyVec(targetParticle.PredictedPosition)
+			particleCollection.handleSimulationEdges(particleIndex)
+		}
+	})
+}
+
+// Create a worker to calculate λ_i = -C_i / (Σ_k |∇_k C_i|^2 + ε) for each particle at the predicted positions.
+//
+// The constraint is only enforced when the particle is compressed, so that particles
+// on the surface are not pulled together by their neighborhood deficiency.
+func (solver *pbfSolver) calculateLambdaWorker(particleCollection *ParticleCollection) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		simulationConfig := particleCollection.simulationConfig
+		gradientVec := particleCollection.newVector()
+		gradientSum := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetPhase := particleCollection.particlePhase(particleIndex)
+			constraintGradientScale := targetPhase.ParticleMass / targetPhase.RestDensity
+			constraint := max(particleCollection.densities[particleIndex]/targetPhase.RestDensity-1, 0)
+			if constraint == 0 {
+				solver.lambdas[particleIndex] = 0
+				continue
+			}
+
+			gradientSum.Zero()
+			gradientDotSum := 0.0
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+					continue
+				}
+				gradientVec.ScaleVec(constraintGradientScale, gradientVec)
+				gradientSum.AddVec(gradientSum, gradientVec)
+				gradientDotSum += mat.Dot(gradientVec, gradientVec)
+			}
+
+			// The boundary cannot move, so only contributes to the gradient with respect to the particle itself
+			particleCollection.calculateBoundaryGradientSum(gradientVec, particleIndex)
+			gradientSum.AddScaledVec(gradientSum, 1/targetPhase.RestDensity, gradientVec)
+
+			solver.lambdas[particleIndex] = -constraint / (mat.Dot(gradientSum, gradientSum) + gradientDotSum + simulationConfig.PBFRelaxation)
+		}
+	}
+}
+
+// Create a worker to calculate the position correction of each particle, Δp_i = m_i/ρ_0 Σ (λ_i + λ_j + s_corr) ∇W_ij.
+//
+// The artificial pressure term s_corr = -k (W(r)/W(Δq))^n keeps particles from clustering.
+// The boundary correction over a step of the given size is equivalent to a boundary pressure term of -λ_i / (ρ_0 Δt^2).
+func (solver *pbfSolver) calculatePositionCorrectionWorker(particleCollection *ParticleCollection, stepSize float64) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		simulationConfig := particleCollection.simulationConfig
+		tensileReferenceValue := particleCollection.densityKernel.Value(simulationConfig.PBFTensileDistance * simulationConfig.SmoothingKernelRadius)
+		gradientVec := particleCollection.newVector()
+		displacementVec := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetPhase := particleCollection.particlePhase(particleIndex)
+			correctionScale := targetPhase.ParticleMass / targetPhase.RestDensity
+			correction := solver.corrections[particleIndex]
+			correction.Zero()
+
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+					continue
+				}
+
+				artificialPressure := 0.0
+				if tensileReferenceValue > 0 {
+					particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, particleCollection.Particles[neighborIndex].PredictedPosition)
+					kernelRatio := particleCollection.densityKernel.Value(displacementVec.Norm(2)) / tensileReferenceValue
+					artificialPressure = -simulationConfig.PBFTensileStrength * math.Pow(kernelRatio, simulationConfig.PBFTensileExponent)
+				}
+
+				scale := correctionScale * (solver.lambdas[particleIndex] + solver.lambdas[neighborIndex] + artificialPressure)
+				correction.AddScaledVec(correction, scale, gradientVec)
+			}
+			particleCollection.calculateBoundaryGradientSum(gradientVec, particleIndex)
+			correction.AddScaledVec(correction, solver.lambdas[particleIndex]/targetPhase.RestDensity, gradientVec)
+			particleCollection.boundaryPressureTerms[particleIndex] -= solver.lambdas[particleIndex] / (targetPhase.RestDensity * stepSize * stepSize)
+		}
+	}
+}
+
+// Create a worker to calculate the XSPH velocity correction of each particle, c Σ m_j/ρ_j (v_j - v_i) W_ij,
+// which blends the velocity of each particle towards that of its neighbors
+func (solver *pbfSolver) calculateXSPHCorrectionWorker(particleCollection *ParticleCollection) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		simulationConfig := particleCollection.simulationConfig
+		displacementVec := particleCollection.newVector()
+		velocityDifferential := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			correction := solver.corrections[particleIndex]
+			correction.Zero()
+
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if particleIndex == neighborIndex {
+					continue
+				}
+
+				neighborParticle := particleCollection.Particles[neighborIndex]
+				particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, neighborParticle.PredictedPosition)
+				influence := particleCollection.densityKernel.Value(displacementVec.Norm(2))
+				velocityDifferential.SubVec(neighborParticle.PredictedVelocity, targetParticle.PredictedVelocity)
+				scale := simulationConfig.XSPHViscosity * particleCollection.particlePhase(neighborIndex).ParticleMass / particleCollection.densities[neighborIndex] * influence
+				correction.AddScaledVec(correction, scale, velocityDifferential)
+			}
+		}
+	}
+}
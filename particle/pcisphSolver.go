@@ -0,0 +1,223 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Predictive-corrective incompressible SPH, following Solenthaler and Pajarola (2009).
+//
+// Each step first calculates all non-pressure accelerations. The pressure of each particle is then found iteratively:
+// the particles are advanced to predicted positions, the density is calculated at those positions, and the pressure
+// is corrected in proportion to the density error. This repeats until the largest density error is below the tolerance.
+type pcisphSolver struct {
+	// The pressure correction factor (δ in the paper) of each phase for a step size of one.
+	// The factor for any other step size is this divided by the step size squared
+	unitCorrectionFactors []float64
+
+	// The density each phase is corrected towards. This is the rest density, unless a particle on its own is already denser
+	// (i.e. the SmoothingKernelRadius is small compared to the rest spacing), as no pressure can reduce the density below that
+	targetDensities []float64
+
+	// The correction factor of each particle for a step size of one.
+	//
+	// The prototype factor above assumes every particle has a neighborhood at rest spacing, which
+	// greatly overestimates the factor for particles that are heavily compressed, causing the pressure
+	// to overshoot and diverge. Each particle instead uses the smaller of the prototype factor and
+	// the factor calculated from its own neighborhood at the start of the step.
+	particleCorrectionFactors []float64
+
+	pressures             []float64
+	pressureAccelerations []*mat.VecDense
+
+	// The (non-negative) density error of each particle in the most recent iteration, relative to its target density
+	densityErrors []float64
+}
+
+func (solver *pcisphSolver) Step(particleCollection *ParticleCollection, stepSize float64) {
+	simulationConfig := particleCollection.simulationConfig
+	particleCollection.solverStatistics = SolverStatistics{}
+	if solver.unitCorrectionFactors == nil {
+		for _, phase := range simulationConfig.Phases {
+			solver.unitCorrectionFactors = append(solver.unitCorrectionFactors, solver.calculateUnitCorrectionFactor(particleCollection, phase))
+			solver.targetDensities = append(solver.targetDensities, max(phase.RestDensity, phase.ParticleMass*particleCollection.densityKernel.Value(0)))
+		}
+	}
+
+	for len(solver.pressures) < len(particleCollection.Particles) {
+		solver.particleCorrectionFactors = append(solver.particleCorrectionFactors, 0)
+		solver.pressures = append(solver.pressures, 0)
+		solver.pressureAccelerations = append(solver.pressureAccelerations, particleCollection.newVector())
+		solver.densityErrors = append(solver.densityErrors, 0)
+	}
+
+	for particleIndex, p := range particleCollection.Particles {
+		p.resetPredictedState()
+		solver.pressures[particleIndex] = 0
+		solver.pressureAccelerations[particleIndex].Zero()
+	}
+	particleCollection.calculateNonPressureAccelerations()
+	particleCollection.runParticleWorkers(solver.calculateParticleCorrectionFactorWorker(particleCollection))
+
+	for iteration := 0; iteration < simulationConfig.PressureSolverMaxIterations; iteration += 1 {
+		// The particles are rehashed every iteration, as the pressure can move the predicted positions out of their neighboring cells
+		particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+			for particleIndex := range particleIndexChannel {
+				solver.predictParticleState(particleCollection, particleIndex, stepSize)
+			}
+		})
+		particleCollection.spatialHashing.updateSpatialHashing(particleCollection.Particles)
+		particleCollection.runParticleWorkers(particleCollection.calculateDensityWorker)
+
+		// The pressure is corrected by the signed density error, so the pressure of a particle that has
+		// been pushed below rest density falls again, but is never negative
+		particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+			for particleIndex := range particleIndexChannel {
+				targetDensity := solver.targetDensities[particleCollection.Particles[particleIndex].Phase]
+				densityError := particleCollection.densities[particleIndex] - targetDensity
+				solver.densityErrors[particleIndex] = max(densityError, 0) / targetDensity
+				correctionFactor := solver.particleCorrectionFactors[particleIndex] / (stepSize * stepSize)
+				solver.pressures[particleIndex] = max(solver.pressures[particleIndex]+correctionFactor*densityError, 0)
+			}
+		})
+
+		particleCollection.runParticleWorkers(solver.calculatePressureAccelerationWorker(particleCollection))
+
+		maxDensityError := 0.0
+		for particleIndex := range particleCollection.Particles {
+			maxDensityError = max(maxDensityError, solver.densityErrors[particleIndex])
+		}
+		particleCollection.solverStatistics.DensityIterations = iteration + 1
+		particleCollection.solverStatistics.DensityResidual = maxDensityError
+		if iteration+1 >= simulationConfig.PressureSolverMinIterations && maxDensityError <= simulationConfig.PressureSolverTolerance {
+			break
+		}
+	}
+
+	particleCollection.runParticleWorkers(func(particleIndexChannel <-chan int) {
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, stepSize, particleCollection.accelerations[particleIndex])
+			targetParticle.Velocity.AddScaledVec(targetParticle.Velocity, stepSize, solver.pressureAccelerations[particleIndex])
+			targetParticle.Position.AddScaledVec(targetParticle.Position, stepSize, targetParticle.Velocity)
+			particleCollection.handleSimulationEdges(particleIndex)
+		}
+	})
+}
+
+// Set the predicted state of a particle to the state after a step using the current pressure accelerations
+func (solver *pcisphSolver) predictParticleState(particleCollection *ParticleCollection, particleIndex int, stepSize float64) {
+	targetParticle := particleCollection.Particles[particleIndex]
+	targetParticle.PredictedVelocity.AddScaledVec(targetParticle.Velocity, stepSize, particleCollection.accelerations[particleIndex])
+	targetParticle.PredictedVelocity.AddScaledVec(targetParticle.PredictedVelocity, stepSize, solver.pressureAccelerations[particleIndex])
+	targetParticle.PredictedPosition.AddScaledVec(targetParticle.Position, stepSize, targetParticle.PredictedVelocity)
+	particleCollection.clampToSimulation(targetParticle.PredictedPosition)
+}
+
+// Create a worker to calculate the acceleration due to the current pressures, at the predicted positions
+func (solver *pcisphSolver) calculatePressureAccelerationWorker(particleCollection *ParticleCollection) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		gradientVec := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			pressureAcceleration := solver.pressureAccelerations[particleIndex]
+			pressureAcceleration.Zero()
+
+			targetPressureTerm := solver.pressures[particleIndex] / math.Pow(particleCollection.densities[particleIndex], 2)
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+					continue
+				}
+
+				neighborPressureTerm := solver.pressures[neighborIndex] / math.Pow(particleCollection.densities[neighborIndex], 2)
+				scale := -particleCollection.particlePhase(neighborIndex).ParticleMass * (targetPressureTerm + neighborPressureTerm)
+				pressureAcceleration.AddScaledVec(pressureAcceleration, scale, gradientVec)
+			}
+			particleCollection.boundaryPressureTerms[particleIndex] = targetPressureTerm
+			particleCollection.addBoundaryPressureAcceleration(pressureAcceleration, particleIndex, targetPressureTerm)
+		}
+	}
+}
+
+// Create a worker to calculate the correction factor of each particle from the current neighborhoods, for a step size of one
+func (solver *pcisphSolver) calculateParticleCorrectionFactorWorker(particleCollection *ParticleCollection) func(<-chan int) {
+	return func(particleIndexChannel <-chan int) {
+		gradientVec := particleCollection.newVector()
+		gradientSum := particleCollection.newVector()
+		for particleIndex := range particleIndexChannel {
+			targetParticle := particleCollection.Particles[particleIndex]
+			targetPhase := particleCollection.particlePhase(particleIndex)
+			gradientSum.Zero()
+			gradientDotSum := 0.0
+
+			neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+			for _, neighborIndex := range neighboringParticleIndices {
+				if !particleCollection.calculatePressureKernelGradient(gradientVec, particleIndex, neighborIndex) {
+					continue
+				}
+				gradientSum.AddVec(gradientSum, gradientVec)
+				gradientDotSum += mat.Dot(gradientVec, gradientVec)
+			}
+
+			// A particle without neighbors cannot be corrected, even if its own contribution to its density is above rest density
+			gradientDenominator := mat.Dot(gradientSum, gradientSum) + gradientDotSum
+			if gradientDenominator == 0 {
+				solver.particleCorrectionFactors[particleIndex] = 0
+				continue
+			}
+			solver.particleCorrectionFactors[particleIndex] = min(
+				solver.unitCorrectionFactors[targetParticle.Phase],
+				solver.correctionFactorFromGradients(targetPhase, gradientDenominator),
+			)
+		}
+	}
+}
+
+// Find the correction factor of a particle of the given phase for a step size of one,
+// given the sum of |Σ∇W|^2 and Σ|∇W|^2 over a neighborhood
+func (solver *pcisphSolver) correctionFactorFromGradients(phase *config.PhaseConfig, gradientDenominator float64) float64 {
+	if gradientDenominator == 0 {
+		return math.Inf(1)
+	}
+	massDensityRatio := phase.ParticleMass / phase.RestDensity
+	return 1 / (2 * massDensityRatio * massDensityRatio * gradientDenominator)
+}
+
+// Calculate the pressure correction factor of a phase for a step size of one, using a prototype particle
+// with a full neighborhood of particles on a grid (or, in three dimensions, a cubic lattice) at the rest spacing of that phase.
+//
+// If the SmoothingKernelRadius does not reach the rest spacing the prototype has no neighbors and the factor is infinite,
+// so each particle uses the factor of its own neighborhood instead
+func (solver *pcisphSolver) calculateUnitCorrectionFactor(particleCollection *ParticleCollection, phase config.PhaseConfig) float64 {
+	kernelRadius := particleCollection.simulationConfig.SmoothingKernelRadius
+	restSpacing := math.Pow(phase.ParticleMass/phase.RestDensity, 1/float64(particleCollection.dimensions))
+
+	gradientSum := particleCollection.newVector()
+	gradientDotSum := 0.0
+	gridExtent := int(math.Ceil(kernelRadius / restSpacing))
+	depthExtent := 0
+	if particleCollection.dimensions == 3 {
+		depthExtent = gridExtent
+	}
+	for i := -gridExtent; i <= gridExtent; i += 1 {
+		for j := -gridExtent; j <= gridExtent; j += 1 {
+			for k := -depthExtent; k <= depthExtent; k += 1 {
+				latticePoint := []float64{float64(i) * restSpacing, float64(j) * restSpacing, float64(k) * restSpacing}
+				displacementVec := mat.NewVecDense(particleCollection.dimensions, latticePoint[:particleCollection.dimensions])
+				displacementMagnitude := displacementVec.Norm(2)
+				if displacementMagnitude == 0 || displacementMagnitude >= kernelRadius {
+					continue
+				}
+
+				displacementVec.ScaleVec(particleCollection.pressureKernel.Gradient(displacementMagnitude)/displacementMagnitude, displacementVec)
+				gradientSum.AddVec(gradientSum, displacementVec)
+				gradientDotSum += mat.Dot(displacementVec, displacementVec)
+			}
+		}
+	}
+
+	return solver.correctionFactorFromGradients(&phase, mat.Dot(gradientSum, gradientSum)+gradientDotSum)
+}
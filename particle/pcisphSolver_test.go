@@ -0,0 +1,51 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// A block of particles compressed below the rest spacing must be corrected to within the tolerance in a single step
+func TestPCISPHCorrectsCompressedBlock(t *testing.T) {
+	const restSpacing = 20.0
+	const compression = 0.95
+	const blockSize = 12
+
+	simulationConfig := config.CreateDefaultConfig()
+	simulationConfig.RandomSeed = 1
+	simulationConfig.Solver = "PCISPH"
+	simulationConfig.GravityStrength = 0
+	simulationConfig.SmoothingKernelRadius = 3 * restSpacing
+	simulationConfig.PressureSolverMaxIterations = 100
+	simulationConfig.NumParticles = 0
+	simulationConfig.Phases[0].NumParticles = 0
+
+	// Use the density of an infinite lattice at the rest spacing as the rest density, so an uncompressed block is at rest
+	densityKernel := newSmoothingKernel(simulationConfig.DensityKernel, simulationConfig.SmoothingKernelRadius, simulationConfig.PowerKernelExponent, 2)
+	latticeDensity := 0.0
+	for i := -3; i <= 3; i += 1 {
+		for j := -3; j <= 3; j += 1 {
+			latticeDensity += simulationConfig.Phases[0].ParticleMass * densityKernel.Value(restSpacing*math.Hypot(float64(i), float64(j)))
+		}
+	}
+	simulationConfig.Phases[0].RestDensity = latticeDensity
+
+	particleCollection := CreateParticleCollection(simulationConfig)
+	for i := 0; i < blockSize; i += 1 {
+		for j := 0; j < blockSize; j += 1 {
+			position := []float64{400 + float64(i)*compression*restSpacing, 150 + float64(j)*compression*restSpacing}
+			particleCollection.addParticle(particleCollection.newParticle(position, 0))
+		}
+	}
+	particleCollection.TickParticles()
+
+	statistics := particleCollection.SolverStatistics()
+	if statistics.DensityResidual > simulationConfig.PressureSolverTolerance {
+		t.Errorf("density residual %v after %v iterations is above the tolerance %v",
+			statistics.DensityResidual, statistics.DensityIterations, simulationConfig.PressureSolverTolerance)
+	}
+	if statistics.DensityIterations >= simulationConfig.PressureSolverMaxIterations {
+		t.Errorf("pressure solver did not converge within %v iterations", simulationConfig.PressureSolverMaxIterations)
+	}
+}
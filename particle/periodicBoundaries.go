@@ -0,0 +1,86 @@
+package particle
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Periodic boundaries join opposite edges of the simulation along the periodic axes, so particles
+// leaving one edge re-enter at the opposite edge, and particles near opposite edges are neighbors.
+
+// Wrap a coordinate along a periodic axis of the given size into [0, size)
+func wrapCoordinate(coordinate float64, size float64) float64 {
+	coordinate = math.Mod(coordinate, size)
+	if coordinate < 0 {
+		coordinate += size
+	}
+	if coordinate >= size {
+		coordinate = 0
+	}
+	return coordinate
+}
+
+// Get whether each axis is periodic, indexed by xDIR, yDIR, and (in three dimensions) zDIR
+func (particleCollection *ParticleCollection) periodicAxes() []bool {
+	simulationConfig := particleCollection.simulationConfig
+	return []bool{simulationConfig.PeriodicX, simulationConfig.PeriodicY, simulationConfig.PeriodicZ}[:particleCollection.dimensions]
+}
+
+// Get the size of the simulation along each axis, indexed by xDIR, yDIR, and (in three dimensions) zDIR
+func (particleCollection *ParticleCollection) simulationSizes() []float64 {
+	simulationConfig := particleCollection.simulationConfig
+	return []float64{
+		float64(simulationConfig.SimulationWidth),
+		float64(simulationConfig.SimulationHeight),
+		float64(simulationConfig.SimulationDepth),
+	}[:particleCollection.dimensions]
+}
+
+// Calculate the displacement from positionB to positionA, storing the result in displacementVec.
+//
+// Along periodic axes this is the shortest displacement, which may cross the periodic seam.
+func (particleCollection *ParticleCollection) calculateDisplacement(displacementVec *mat.VecDense, positionA *mat.VecDense, positionB *mat.VecDense) {
+	displacementVec.SubVec(positionA, positionB)
+	simulationSizes := particleCollection.simulationSizes()
+	for direction, periodic := range particleCollection.periodicAxes() {
+		if !periodic {
+			continue
+		}
+		displacement := displacementVec.AtVec(direction)
+		displacementVec.SetVec(direction, displacement-simulationSizes[direction]*math.Round(displacement/simulationSizes[direction]))
+	}
+}
+
+// Get the shortest offset equivalent to the given offset along an axis, which is the offset itself unless the axis is periodic
+func (particleCollection *ParticleCollection) periodicOffset(offset float64, direction int) float64 {
+	simulationConfig := particleCollection.simulationConfig
+	periodic, simulationSize := simulationConfig.PeriodicX, float64(simulationConfig.SimulationWidth)
+	switch direction {
+	case yDIR:
+		periodic, simulationSize = simulationConfig.PeriodicY, float64(simulationConfig.SimulationHeight)
+	case zDIR:
+		periodic, simulationSize = simulationConfig.PeriodicZ, float64(simulationConfig.SimulationDepth)
+	}
+	if !periodic {
+		return offset
+	}
+	return offset - simulationSize*math.Round(offset/simulationSize)
+}
+
+// Get the image of a point in the x-y plane across the periodic seams that is closest to the given center.
+// In three dimensions the z coordinate of the center is ignored
+func (particleCollection *ParticleCollection) nearestPeriodicImage(x float64, y float64, center *mat.VecDense) (float64, float64) {
+	centerX, centerY := center.AtVec(xDIR), center.AtVec(yDIR)
+	return centerX + particleCollection.periodicOffset(x-centerX, xDIR), centerY + particleCollection.periodicOffset(y-centerY, yDIR)
+}
+
+// Wrap a position into the simulation along the periodic axes
+func (particleCollection *ParticleCollection) wrapPeriodicPosition(position *mat.VecDense) {
+	simulationSizes := particleCollection.simulationSizes()
+	for direction, periodic := range particleCollection.periodicAxes() {
+		if periodic {
+			position.SetVec(direction, wrapCoordinate(position.AtVec(direction), simulationSizes[direction]))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// Create a collection periodic along both axes with a jittered, moving block of particles centered on the given point
+func createPeriodicBlockCollection(centerX float64, centerY float64) *ParticleCollection {
+	const blockSize = 6
+	const spacing = 8.0
+
+	simulationConfig := config.CreateDefaultConfig()
+	simulationConfig.PeriodicX = true
+	simulationConfig.PeriodicY = true
+	simulationConfig.ViscosityCoefficient = 0.01
+	simulationConfig.SurfaceTensionCoefficient = 0.1
+	simulationConfig.NumParticles = 0
+	simulationConfig.Phases[0].NumParticles = 0
+	particleCollection := CreateParticleCollection(simulationConfig)
+
+	for i := 0; i < blockSize; i += 1 {
+		for j := 0; j < blockSize; j += 1 {
+			offsetX := (float64(i)-(blockSize-1)/2.0)*spacing + math.Sin(float64(3*i+j))
+			offsetY := (float64(j)-(blockSize-1)/2.0)*spacing + math.Cos(float64(i+5*j))
+			position := []float64{
+				wrapCoordinate(centerX+offsetX, float64(simulationConfig.SimulationWidth)),
+				wrapCoordinate(centerY+offsetY, float64(simulationConfig.SimulationHeight)),
+			}
+			particle := particleCollection.newParticle(position, 0)
+			particle.Velocity.SetVec(xDIR, math.Sin(float64(i*j)))
+			particle.Velocity.SetVec(yDIR, math.Cos(float64(i+j)))
+			particleCollection.addParticle(particle)
+		}
+	}
+	for _, particle := range particleCollection.Particles {
+		particle.resetPredictedState()
+	}
+	particleCollection.calculateAccelerations()
+	return particleCollection
+}
+
+// A block of particles straddling the periodic seams must have the same densities and accelerations as the same block in the middle of the simulation
+func TestPeriodicSeamIsContinuous(t *testing.T) {
+	seamCollection := createPeriodicBlockCollection(0, 0)
+	middleCollection := createPeriodicBlockCollection(512, 256)
+
+	for particleIndex := range seamCollection.Particles {
+		seamDensity, middleDensity := seamCollection.densities[particleIndex], middleCollection.densities[particleIndex]
+		if math.Abs(seamDensity-middleDensity) > 1e-9*middleDensity {
+			t.Errorf("particle %v has density %v at the seam, but %v in the middle", particleIndex, seamDensity, middleDensity)
+		}
+		seamAcceleration := seamCollection.accelerations[particleIndex].RawVector().Data
+		middleAcceleration := middleCollection.accelerations[particleIndex].RawVector().Data
+		if !vectorsClose(seamAcceleration, middleAcceleration) {
+			t.Errorf("particle %v has acceleration %v at the seam, but %v in the middle", particleIndex, seamAcceleration, middleAcceleration)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package particle
+
+// Get a uniformly random value in [0, 1) for a particle during the current step.
+//
+// Rather than drawing from the shared random number generator, which would make the result depend on the order
+// the worker threads reach each particle, the value is derived from the RandomSeed, the step count, the particle index,
+// and a stream number distinguishing the values needed for the same particle in the same step.
+// This is safe to call from any worker thread, and a given seed always gives the same values.
+func (particleCollection *ParticleCollection) particleRandomFloat(particleIndex int, stream int) float64 {
+	state := particleCollection.simulationConfig.RandomSeed
+	state = splitMix64(state ^ particleCollection.stepCount)
+	state = splitMix64(state ^ uint64(particleIndex))
+	state = splitMix64(state ^ uint64(stream))
+
+	// The top 53 bits fill the mantissa of a float64 exactly
+	return float64(state>>11) / (1 << 53)
+}
+
+// The SplitMix64 mixing function (Steele et al. 2014), which scrambles the bits of its input
+// so that nearby inputs give unrelated outputs
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
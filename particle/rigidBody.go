@@ -0,0 +1,320 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// A rigid body that is moved by the fluid, and moves the fluid in turn.
+//
+// Bodies are coupled to the particles through boundary particles (Akinci et al. 2012) placed inside the outline
+// of the body, which the fluid sees as a moving boundary. Each boundary particle b is pushed back by every nearby particle i
+// with the opposite of the pressure and viscous forces it exerts on that particle,
+// m_i Ψ_b (p_i / ρ_i^2) ∇W_ib + m_i (μ_i / ρ_i) V_b (v_i - v_b) ∇²W_ib, and these forces are summed into the force and torque
+// on the body, so bodies float, sink, tumble, and are dragged along by the flow. Bodies collide with the obstacles and
+// the edges of the simulation through impulses, and any particle that still ends a step inside a body is moved to its surface.
+type RigidBody struct {
+	placedShape
+	shapeBoundary
+
+	density         float64
+	mass            float64
+	momentOfInertia float64
+}
+
+func newRigidBody(rigidBodyConfig config.RigidBodyConfig) *RigidBody {
+	if rigidBodyConfig.Density <= 0 {
+		log.Panicf("rigid body must have a positive density, got %v", rigidBodyConfig.Density)
+	}
+
+	bodyShape := newShape(rigidBodyConfig.ShapeConfig)
+	return &RigidBody{
+		placedShape: placedShape{
+			Position:        mat.NewVecDense(2, []float64{rigidBodyConfig.PositionX, rigidBodyConfig.PositionY}),
+			Angle:           rigidBodyConfig.Angle,
+			Velocity:        mat.NewVecDense(2, []float64{rigidBodyConfig.VelocityX, rigidBodyConfig.VelocityY}),
+			AngularVelocity: rigidBodyConfig.AngularVelocity,
+			shape:           bodyShape,
+		},
+		density:         rigidBodyConfig.Density,
+		mass:            rigidBodyConfig.Density * bodyShape.area(),
+		momentOfInertia: rigidBodyConfig.Density * bodyShape.secondMomentOfArea(),
+	}
+}
+
+// Get the inverse of the effective mass of the body for an impulse along the given normal,
+// applied at the given offset from the centroid, 1/m + (r × n)^2 / I
+func (body *RigidBody) inverseEffectiveMass(offsetX float64, offsetY float64, normalX float64, normalY float64) float64 {
+	offsetCrossNormal := offsetX*normalY - offsetY*normalX
+	return 1/body.mass + offsetCrossNormal*offsetCrossNormal/body.momentOfInertia
+}
+
+// Apply an impulse to the body at the given offset from the centroid
+func (body *RigidBody) applyImpulse(impulseX float64, impulseY float64, offsetX float64, offsetY float64) {
+	body.Velocity.SetVec(xDIR, body.Velocity.AtVec(xDIR)+impulseX/body.mass)
+	body.Velocity.SetVec(yDIR, body.Velocity.AtVec(yDIR)+impulseY/body.mass)
+	body.AngularVelocity += (offsetX*impulseY - offsetY*impulseX) / body.momentOfInertia
+}
+
+// Advance every rigid body by one step, and resolve collisions with the edges of the simulation, the obstacles, and the particles.
+//
+// The forces on each body and the collisions are found one at a time in a fixed order, so the result does not depend on the number of worker threads.
+func (particleCollection *ParticleCollection) stepRigidBodies(stepSize float64) {
+	for _, body := range particleCollection.RigidBodies {
+		forceX, forceY, torque := particleCollection.calculateRigidBodyFluidForce(body)
+		gravityX, gravityY := particleCollection.gravityAcceleration(body.density)
+		fieldAccelerationX, fieldAccelerationY := particleCollection.rigidBodyForceFieldAcceleration()
+		body.Velocity.SetVec(xDIR, body.Velocity.AtVec(xDIR)+stepSize*(forceX/body.mass+gravityX+fieldAccelerationX))
+		body.Velocity.SetVec(yDIR, body.Velocity.AtVec(yDIR)+stepSize*(forceY/body.mass+gravityY+fieldAccelerationY))
+		body.AngularVelocity += stepSize * torque / body.momentOfInertia
+		body.Position.AddScaledVec(body.Position, stepSize, body.Velocity)
+		body.Angle += stepSize * body.AngularVelocity
+		particleCollection.wrapPeriodicPosition(body.Position)
+
+		particleCollection.handleRigidBodyEdges(body)
+		particleCollection.handleRigidBodyObstacles(body)
+		particleCollection.handleRigidBodyParticleCollisions(body)
+		particleCollection.moveShapeBoundary(&body.placedShape, &body.shapeBoundary)
+	}
+
+	if len(particleCollection.RigidBodies) > 0 {
+		particleCollection.boundarySpatialHashing.updateSpatialHashing(particleCollection.boundaryParticles)
+	}
+}
+
+// Calculate the force on a rigid body due to the particles near its boundary particles, and the torque of that force about the centroid.
+//
+// The pressure of each particle is the pressure it pushed against the boundary with over the most recent step.
+func (particleCollection *ParticleCollection) calculateRigidBodyFluidForce(body *RigidBody) (float64, float64, float64) {
+	kernelRadius := particleCollection.simulationConfig.SmoothingKernelRadius
+	displacementVec := mat.NewVecDense(2, nil)
+	forceX, forceY, torque := 0.0, 0.0, 0.0
+
+	nearbyParticleIndices := particleCollection.spatialHashing.getParticleIndicesNearPoint(
+		body.Position.AtVec(xDIR), body.Position.AtVec(yDIR), body.shape.boundingRadius()+kernelRadius)
+	for _, particleIndex := range nearbyParticleIndices {
+		p := particleCollection.Particles[particleIndex]
+		particleMass := particleCollection.particlePhase(particleIndex).ParticleMass
+		viscosityScale := particleMass * particleCollection.particleViscosity(particleIndex) / particleCollection.densities[particleIndex]
+		for localIndex := range body.boundaryLocalPositions {
+			boundaryIndex := body.boundaryParticleStart + localIndex
+			boundaryParticle := particleCollection.boundaryParticles[boundaryIndex]
+			particleCollection.calculateDisplacement(displacementVec, p.Position, boundaryParticle.Position)
+			distance := displacementVec.Norm(2)
+			if distance == 0 || distance >= kernelRadius {
+				continue
+			}
+
+			pressureScale := particleMass * particleCollection.boundaryMass(particleIndex, boundaryIndex) * particleCollection.boundaryPressureTerms[particleIndex] *
+				particleCollection.pressureKernel.Gradient(distance) / distance
+			boundaryForceX := pressureScale * displacementVec.AtVec(xDIR)
+			boundaryForceY := pressureScale * displacementVec.AtVec(yDIR)
+
+			viscosityLaplacian := particleCollection.viscosityKernel.Laplacian(distance)
+			if !math.IsInf(viscosityLaplacian, 0) {
+				viscousScale := viscosityScale * particleCollection.boundaryVolumes[boundaryIndex] * viscosityLaplacian
+				boundaryForceX += viscousScale * (p.Velocity.AtVec(xDIR) - boundaryParticle.Velocity.AtVec(xDIR))
+				boundaryForceY += viscousScale * (p.Velocity.AtVec(yDIR) - boundaryParticle.Velocity.AtVec(yDIR))
+			}
+
+			offsetX := particleCollection.periodicOffset(boundaryParticle.Position.AtVec(xDIR)-body.Position.AtVec(xDIR), xDIR)
+			offsetY := particleCollection.periodicOffset(boundaryParticle.Position.AtVec(yDIR)-body.Position.AtVec(yDIR), yDIR)
+			forceX += boundaryForceX
+			forceY += boundaryForceY
+			torque += offsetX*boundaryForceY - offsetY*boundaryForceX
+		}
+	}
+	return forceX, forceY, torque
+}
+
+// Add the viscous force density on a particle at the predicted state due to the boundary particles of the rigid bodies,
+// μ_i Σ_b V_b (v_b - v_i) ∇²W_ib, so that moving bodies drag the fluid along with them.
+// Coincident particles are skipped if the Laplacian is singular at zero distance
+func (particleCollection *ParticleCollection) addRigidBodyViscousForce(force *mat.VecDense, particleIndex int, displacementVec *mat.VecDense, velocityDifferential *mat.VecDense) {
+	if len(particleCollection.RigidBodies) == 0 {
+		return
+	}
+
+	targetParticle := particleCollection.Particles[particleIndex]
+	viscosity := particleCollection.particleViscosity(particleIndex)
+	for _, boundaryIndex := range particleCollection.getNeighboringBoundaryIndices(targetParticle) {
+		if boundaryIndex < particleCollection.rigidBodyBoundaryStart {
+			continue
+		}
+
+		boundaryParticle := particleCollection.boundaryParticles[boundaryIndex]
+		particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, boundaryParticle.Position)
+		viscosityLaplacian := particleCollection.viscosityKernel.Laplacian(displacementVec.Norm(2))
+		if math.IsInf(viscosityLaplacian, 0) {
+			continue
+		}
+		velocityDifferential.SubVec(boundaryParticle.Velocity, targetParticle.PredictedVelocity)
+		force.AddScaledVec(force, viscosity*particleCollection.boundaryVolumes[boundaryIndex]*viscosityLaplacian, velocityDifferential)
+	}
+}
+
+// Keep a rigid body inside the simulation.
+//
+// For each edge the outline points past that edge are found. The body is moved back by the deepest penetration,
+// and an impulse is applied at the average of those points so that a body resting flat on an edge does not spin.
+// Edges along periodic axes are skipped, as the centroid of the body is wrapped around instead.
+func (particleCollection *ParticleCollection) handleRigidBodyEdges(body *RigidBody) {
+	simulationWidth := float64(particleCollection.simulationConfig.SimulationWidth)
+	simulationHeight := float64(particleCollection.simulationConfig.SimulationHeight)
+	periodicAxes := particleCollection.periodicAxes()
+
+	// Each edge is given by its inward normal, its offset along that normal, and the axis it bounds
+	edges := []struct {
+		normalX, normalY, edgeOffset float64
+		direction                    int
+	}{
+		{1, 0, 0, xDIR},
+		{-1, 0, -simulationWidth, xDIR},
+		{0, 1, 0, yDIR},
+		{0, -1, -simulationHeight, yDIR},
+	}
+	for _, edge := range edges {
+		if periodicAxes[edge.direction] {
+			continue
+		}
+		normalX, normalY, edgeOffset := edge.normalX, edge.normalY, edge.edgeOffset
+
+		penetratingPoints := 0
+		deepestPenetration := 0.0
+		contactOffsetX, contactOffsetY := 0.0, 0.0
+		for _, localPoint := range body.shape.outline() {
+			offsetX, offsetY := body.rotate(localPoint[0], localPoint[1])
+			penetration := edgeOffset - ((body.Position.AtVec(xDIR)+offsetX)*normalX + (body.Position.AtVec(yDIR)+offsetY)*normalY)
+			if penetration > 0 {
+				penetratingPoints += 1
+				deepestPenetration = max(deepestPenetration, penetration)
+				contactOffsetX += offsetX
+				contactOffsetY += offsetY
+			}
+		}
+		if penetratingPoints == 0 {
+			continue
+		}
+		contactOffsetX /= float64(penetratingPoints)
+		contactOffsetY /= float64(penetratingPoints)
+		particleCollection.resolveRigidBodyContact(body, normalX, normalY, deepestPenetration, contactOffsetX, contactOffsetY, 0, 0)
+	}
+}
+
+// Keep a rigid body out of the obstacles.
+//
+// Both the outline points of the body inside an obstacle and the outline points of the obstacle inside the body
+// are found, and whichever set contains the deepest point is resolved in the same way as for the edges
+func (particleCollection *ParticleCollection) handleRigidBodyObstacles(body *RigidBody) {
+	for _, obstacle := range particleCollection.Obstacles {
+		bodyOutline := body.Outline()
+		obstacleOutline := obstacle.Outline()
+
+		// The outline points of the body inside the obstacle push the body along the obstacle normal,
+		// while the outline points of the obstacle inside the body push the body against the body normal
+		contactSets := []struct {
+			points   []*mat.VecDense
+			surface  *placedShape
+			pushSign float64
+		}{
+			{bodyOutline, &obstacle.placedShape, 1},
+			{obstacleOutline, &body.placedShape, -1},
+		}
+
+		deepestPenetration := 0.0
+		normalX, normalY := 0.0, 0.0
+		contactOffsetX, contactOffsetY := 0.0, 0.0
+		for _, contactSet := range contactSets {
+			penetratingPoints := 0
+			setDeepestPenetration := 0.0
+			setNormalX, setNormalY := 0.0, 0.0
+			setContactOffsetX, setContactOffsetY := 0.0, 0.0
+			for _, point := range contactSet.points {
+				distance, pointNormalX, pointNormalY := contactSet.surface.signedDistance(point.AtVec(xDIR), point.AtVec(yDIR))
+				if distance >= 0 {
+					continue
+				}
+				penetratingPoints += 1
+				setContactOffsetX += point.AtVec(xDIR) - body.Position.AtVec(xDIR)
+				setContactOffsetY += point.AtVec(yDIR) - body.Position.AtVec(yDIR)
+				if -distance > setDeepestPenetration {
+					setDeepestPenetration = -distance
+					setNormalX, setNormalY = contactSet.pushSign*pointNormalX, contactSet.pushSign*pointNormalY
+				}
+			}
+			if setDeepestPenetration > deepestPenetration {
+				deepestPenetration = setDeepestPenetration
+				normalX, normalY = setNormalX, setNormalY
+				contactOffsetX = setContactOffsetX / float64(penetratingPoints)
+				contactOffsetY = setContactOffsetY / float64(penetratingPoints)
+			}
+		}
+
+		if deepestPenetration > 0 {
+			surfaceVelocityX, surfaceVelocityY := obstacle.velocityAt(
+				body.Position.AtVec(xDIR)+contactOffsetX-obstacle.Position.AtVec(xDIR),
+				body.Position.AtVec(yDIR)+contactOffsetY-obstacle.Position.AtVec(yDIR),
+			)
+			particleCollection.resolveRigidBodyContact(body, normalX, normalY, deepestPenetration, contactOffsetX, contactOffsetY, surfaceVelocityX, surfaceVelocityY)
+		}
+	}
+}
+
+// Move a rigid body by the penetration depth along the contact normal, and apply an impulse at the
+// contact point (given as an offset from the centroid) so that the body is no longer moving against the normal,
+// relative to the velocity of the surface it is in contact with
+func (particleCollection *ParticleCollection) resolveRigidBodyContact(body *RigidBody, normalX float64, normalY float64, penetration float64, contactOffsetX float64, contactOffsetY float64, surfaceVelocityX float64, surfaceVelocityY float64) {
+	body.Position.SetVec(xDIR, body.Position.AtVec(xDIR)+penetration*normalX)
+	body.Position.SetVec(yDIR, body.Position.AtVec(yDIR)+penetration*normalY)
+
+	contactVelocityX, contactVelocityY := body.velocityAt(contactOffsetX, contactOffsetY)
+	normalVelocity := (contactVelocityX-surfaceVelocityX)*normalX + (contactVelocityY-surfaceVelocityY)*normalY
+	if normalVelocity < 0 {
+		impulseMagnitude := -(1 + particleCollection.simulationConfig.CollisionDampingCoefficient) * normalVelocity /
+			body.inverseEffectiveMass(contactOffsetX, contactOffsetY, normalX, normalY)
+		body.applyImpulse(impulseMagnitude*normalX, impulseMagnitude*normalY, contactOffsetX, contactOffsetY)
+	}
+}
+
+// Move every particle inside the body to the surface of the body, and exchange an impulse between
+// the particle and the body so that the particle is no longer moving into the body.
+//
+// The boundary particles of the body should keep particles out, so this only catches particles moving fast enough to pass them
+func (particleCollection *ParticleCollection) handleRigidBodyParticleCollisions(body *RigidBody) {
+	nearbyParticleIndices := particleCollection.spatialHashing.getParticleIndicesNearPoint(body.Position.AtVec(xDIR), body.Position.AtVec(yDIR), body.shape.boundingRadius())
+	for _, particleIndex := range nearbyParticleIndices {
+		p := particleCollection.Particles[particleIndex]
+		positionX, positionY := particleCollection.nearestPeriodicImage(p.Position.AtVec(xDIR), p.Position.AtVec(yDIR), body.Position)
+		if !body.withinBoundingRadius(positionX, positionY) {
+			continue
+		}
+
+		distance, normalX, normalY := body.signedDistance(positionX, positionY)
+		if distance >= 0 {
+			continue
+		}
+
+		// The contact point is the closest point on the surface of the body
+		offsetX := positionX - body.Position.AtVec(xDIR) - distance*normalX
+		offsetY := positionY - body.Position.AtVec(yDIR) - distance*normalY
+		p.Position.SetVec(xDIR, body.Position.AtVec(xDIR)+offsetX)
+		p.Position.SetVec(yDIR, body.Position.AtVec(yDIR)+offsetY)
+		particleCollection.clampToSimulation(p.Position)
+
+		surfaceVelocityX, surfaceVelocityY := body.velocityAt(offsetX, offsetY)
+		normalVelocity := (p.Velocity.AtVec(xDIR)-surfaceVelocityX)*normalX + (p.Velocity.AtVec(yDIR)-surfaceVelocityY)*normalY
+		if normalVelocity >= 0 {
+			continue
+		}
+
+		particleMass := particleCollection.particlePhase(particleIndex).ParticleMass
+		impulseMagnitude := -(1 + particleCollection.simulationConfig.CollisionDampingCoefficient) * normalVelocity /
+			(1/particleMass + body.inverseEffectiveMass(offsetX, offsetY, normalX, normalY))
+		p.Velocity.SetVec(xDIR, p.Velocity.AtVec(xDIR)+impulseMagnitude*normalX/particleMass)
+		p.Velocity.SetVec(yDIR, p.Velocity.AtVec(yDIR)+impulseMagnitude*normalY/particleMass)
+		body.applyImpulse(-impulseMagnitude*normalX, -impulseMagnitude*normalY, offsetX, offsetY)
+	}
+}
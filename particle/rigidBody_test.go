@@ -0,0 +1,81 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// The depth at which the box in the tank created by createRigidBodyTankCollection starts
+const rigidBodyStartPositionY = 140.0
+
+// Create a tank of fluid at rest on a lattice, with a box of the given density relative to the fluid placed in the middle of it
+func createRigidBodyTankCollection(solver string, relativeDensity float64) *ParticleCollection {
+	const restSpacing = 10.0
+
+	simulationConfig := config.CreateDefaultConfig()
+	simulationConfig.RandomSeed = 1
+	simulationConfig.Solver = solver
+	simulationConfig.SimulationWidth = 120
+	simulationConfig.SimulationHeight = 200
+	simulationConfig.SmoothingKernelRadius = 2 * restSpacing
+	simulationConfig.GravityModel = "Acceleration"
+	simulationConfig.GravityStrength = 0.01
+	simulationConfig.NumParticles = 0
+	simulationConfig.Phases[0].NumParticles = 0
+	simulationConfig.Phases[0].Viscosity = 0.001
+
+	// Use the density of an infinite lattice at the rest spacing as the rest density, as for the PCISPH test
+	densityKernel := newSmoothingKernel(simulationConfig.DensityKernel, simulationConfig.SmoothingKernelRadius, simulationConfig.PowerKernelExponent, 2)
+	latticeDensity := 0.0
+	for i := -3; i <= 3; i += 1 {
+		for j := -3; j <= 3; j += 1 {
+			latticeDensity += simulationConfig.Phases[0].ParticleMass * densityKernel.Value(restSpacing*math.Hypot(float64(i), float64(j)))
+		}
+	}
+	simulationConfig.Phases[0].RestDensity = latticeDensity
+	simulationConfig.RigidBodies = []config.RigidBodyConfig{{
+		ShapeConfig: config.ShapeConfig{Shape: "Box", Width: 30, Height: 20},
+		Density:     relativeDensity * latticeDensity,
+		PositionX:   60,
+		PositionY:   rigidBodyStartPositionY,
+	}}
+
+	particleCollection := CreateParticleCollection(simulationConfig)
+	body := particleCollection.RigidBodies[0]
+	for x := restSpacing / 2; x < 120; x += restSpacing {
+		for y := 200 - restSpacing/2; y > 80; y -= restSpacing {
+			if distance, _, _ := body.signedDistance(x, y); distance > restSpacing/2 {
+				particleCollection.addParticle(particleCollection.newParticle([]float64{x, y}, 0))
+			}
+		}
+	}
+	return particleCollection
+}
+
+// A box lighter than the fluid must float up towards the surface, while a box heavier than the fluid must sink to the bottom.
+//
+// The explicit solver is left out, as the fluid compresses too far at this step size for the box to settle
+func TestRigidBodiesFloatAndSink(t *testing.T) {
+	const numSteps = 300
+	for _, solver := range []string{"PCISPH", "DFSPH", "PBF"} {
+		t.Run(solver, func(t *testing.T) {
+			lightCollection := createRigidBodyTankCollection(solver, 0.5)
+			heavyCollection := createRigidBodyTankCollection(solver, 2)
+			for step := 0; step < numSteps; step += 1 {
+				lightCollection.TickParticles()
+				heavyCollection.TickParticles()
+			}
+
+			// Remember - y axis starts with 0 at the top and increases *downwards*
+			lightPositionY := lightCollection.RigidBodies[0].Position.AtVec(yDIR)
+			heavyPositionY := heavyCollection.RigidBodies[0].Position.AtVec(yDIR)
+			if lightPositionY > rigidBodyStartPositionY-15 {
+				t.Errorf("light box is at a depth of %v after %v steps, starting from %v", lightPositionY, numSteps, rigidBodyStartPositionY)
+			}
+			if heavyPositionY < rigidBodyStartPositionY+30 {
+				t.Errorf("heavy box is at a depth of %v after %v steps, starting from %v", heavyPositionY, numSteps, rigidBodyStartPositionY)
+			}
+		})
+	}
+}
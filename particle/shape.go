@@ -0,0 +1,264 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// The number of vertices used to approximate the outline of a circle
+const circleOutlineVertices = 32
+
+// A two dimensional shape in its own local coordinates, with the centroid at the origin.
+type shape interface {
+	area() float64
+
+	// The polar second moment of area about the centroid.
+	// Multiplying by the density gives the moment of inertia
+	secondMomentOfArea() float64
+
+	// The largest distance from the centroid to any point of the shape
+	boundingRadius() float64
+
+	// The signed distance from a point to the surface of the shape, negative inside the shape,
+	// and the outward unit normal of the surface at the closest point
+	signedDistance(x float64, y float64) (distance float64, normalX float64, normalY float64)
+
+	// Points on the outline of the shape, in order
+	outline() [][2]float64
+}
+
+// A shape placed in the simulation, with its centroid at Position and rotated by Angle (in radians)
+type placedShape struct {
+	Position *mat.VecDense
+	Angle    float64
+
+	// The velocity of the centroid, and the rate of change of the orientation
+	Velocity        *mat.VecDense
+	AngularVelocity float64
+
+	shape shape
+}
+
+// Get the outline of the shape in simulation coordinates
+func (placed *placedShape) Outline() []*mat.VecDense {
+	localOutline := placed.shape.outline()
+	outline := make([]*mat.VecDense, len(localOutline))
+	for pointIndex, localPoint := range localOutline {
+		offsetX, offsetY := placed.rotate(localPoint[0], localPoint[1])
+		outline[pointIndex] = mat.NewVecDense(2, []float64{placed.Position.AtVec(xDIR) + offsetX, placed.Position.AtVec(yDIR) + offsetY})
+	}
+	return outline
+}
+
+// Get the velocity of the point of the shape at the given offset from the centroid, v + ω × r
+func (placed *placedShape) velocityAt(offsetX float64, offsetY float64) (float64, float64) {
+	return placed.Velocity.AtVec(xDIR) - placed.AngularVelocity*offsetY, placed.Velocity.AtVec(yDIR) + placed.AngularVelocity*offsetX
+}
+
+// Rotate a vector from the local coordinates of the shape into simulation coordinates
+func (placed *placedShape) rotate(x float64, y float64) (float64, float64) {
+	sinAngle, cosAngle := math.Sincos(placed.Angle)
+	return cosAngle*x - sinAngle*y, sinAngle*x + cosAngle*y
+}
+
+// Rotate a vector from simulation coordinates into the local coordinates of the shape
+func (placed *placedShape) unrotate(x float64, y float64) (float64, float64) {
+	sinAngle, cosAngle := math.Sincos(placed.Angle)
+	return cosAngle*x + sinAngle*y, -sinAngle*x + cosAngle*y
+}
+
+// Check if a point in simulation coordinates is within the bounding radius of the shape
+func (placed *placedShape) withinBoundingRadius(x float64, y float64) bool {
+	offsetX := x - placed.Position.AtVec(xDIR)
+	offsetY := y - placed.Position.AtVec(yDIR)
+	boundingRadius := placed.shape.boundingRadius()
+	return offsetX*offsetX+offsetY*offsetY <= boundingRadius*boundingRadius
+}
+
+// Get the signed distance from a point in simulation coordinates to the surface of the shape,
+// and the outward normal at the closest point of the surface in simulation coordinates
+func (placed *placedShape) signedDistance(x float64, y float64) (float64, float64, float64) {
+	localX, localY := placed.unrotate(x-placed.Position.AtVec(xDIR), y-placed.Position.AtVec(yDIR))
+	distance, localNormalX, localNormalY := placed.shape.signedDistance(localX, localY)
+	normalX, normalY := placed.rotate(localNormalX, localNormalY)
+	return distance, normalX, normalY
+}
+
+// Create the shape described by the config
+func newShape(shapeConfig config.ShapeConfig) shape {
+	switch shapeConfig.Shape {
+	case "Circle":
+		if shapeConfig.Radius <= 0 {
+			log.Panicf("circle must have a positive radius, got %v", shapeConfig.Radius)
+		}
+		return &circleShape{radius: shapeConfig.Radius}
+	case "Box":
+		halfWidth := shapeConfig.Width / 2
+		halfHeight := shapeConfig.Height / 2
+		return newPolygonShape([][2]float64{
+			{-halfWidth, -halfHeight},
+			{halfWidth, -halfHeight},
+			{halfWidth, halfHeight},
+			{-halfWidth, halfHeight},
+		})
+	case "Polygon":
+		return newPolygonShape(shapeConfig.Vertices)
+	default:
+		log.Panicf("unknown shape %q", shapeConfig.Shape)
+	}
+	return nil
+}
+
+type circleShape struct {
+	radius float64
+}
+
+func (circle *circleShape) area() float64 {
+	return math.Pi * circle.radius * circle.radius
+}
+
+func (circle *circleShape) secondMomentOfArea() float64 {
+	return math.Pi * math.Pow(circle.radius, 4) / 2
+}
+
+func (circle *circleShape) boundingRadius() float64 {
+	return circle.radius
+}
+
+func (circle *circleShape) signedDistance(x float64, y float64) (float64, float64, float64) {
+	distanceFromCenter := math.Hypot(x, y)
+	if distanceFromCenter == 0 {
+		return -circle.radius, 1, 0
+	}
+	return distanceFromCenter - circle.radius, x / distanceFromCenter, y / distanceFromCenter
+}
+
+func (circle *circleShape) outline() [][2]float64 {
+	points := make([][2]float64, circleOutlineVertices)
+	for pointIndex := range points {
+		angle := 2 * math.Pi * float64(pointIndex) / circleOutlineVertices
+		points[pointIndex] = [2]float64{circle.radius * math.Cos(angle), circle.radius * math.Sin(angle)}
+	}
+	return points
+}
+
+// A simple (non self-intersecting) polygon.
+//
+// The vertices are ordered to have a positive signed area, so the outward normal
+// of the edge from vertex a to vertex b is (b_y - a_y, a_x - b_x), normalized.
+type polygonShape struct {
+	vertices [][2]float64
+	normals  [][2]float64
+
+	polygonArea           float64
+	polygonSecondMoment   float64
+	polygonBoundingRadius float64
+}
+
+// Create a polygon from the given vertices, moving the polygon so that its centroid is at the origin
+func newPolygonShape(vertices [][2]float64) *polygonShape {
+	if len(vertices) < 3 {
+		log.Panicf("polygon must have at least three vertices, got %v", len(vertices))
+	}
+
+	// Shoelace formula for the signed area and centroid
+	signedArea := 0.0
+	centroidX := 0.0
+	centroidY := 0.0
+	for vertexIndex, a := range vertices {
+		b := vertices[(vertexIndex+1)%len(vertices)]
+		cross := a[0]*b[1] - b[0]*a[1]
+		signedArea += cross / 2
+		centroidX += (a[0] + b[0]) * cross / 6
+		centroidY += (a[1] + b[1]) * cross / 6
+	}
+	if signedArea == 0 {
+		log.Panicf("polygon must have a non-zero area, got vertices %v", vertices)
+	}
+	centroidX /= signedArea
+	centroidY /= signedArea
+
+	polygon := &polygonShape{
+		vertices:    make([][2]float64, len(vertices)),
+		normals:     make([][2]float64, len(vertices)),
+		polygonArea: math.Abs(signedArea),
+	}
+	for vertexIndex, vertex := range vertices {
+		if signedArea < 0 {
+			vertex = vertices[len(vertices)-1-vertexIndex]
+		}
+		polygon.vertices[vertexIndex] = [2]float64{vertex[0] - centroidX, vertex[1] - centroidY}
+	}
+
+	for vertexIndex, a := range polygon.vertices {
+		b := polygon.vertices[(vertexIndex+1)%len(polygon.vertices)]
+		cross := a[0]*b[1] - b[0]*a[1]
+		polygon.polygonSecondMoment += cross * (a[0]*a[0] + a[0]*b[0] + b[0]*b[0] + a[1]*a[1] + a[1]*b[1] + b[1]*b[1]) / 12
+		polygon.polygonBoundingRadius = max(polygon.polygonBoundingRadius, math.Hypot(a[0], a[1]))
+
+		edgeLength := math.Hypot(b[0]-a[0], b[1]-a[1])
+		if edgeLength > 0 {
+			polygon.normals[vertexIndex] = [2]float64{(b[1] - a[1]) / edgeLength, (a[0] - b[0]) / edgeLength}
+		}
+	}
+
+	return polygon
+}
+
+func (polygon *polygonShape) area() float64 {
+	return polygon.polygonArea
+}
+
+func (polygon *polygonShape) secondMomentOfArea() float64 {
+	return polygon.polygonSecondMoment
+}
+
+func (polygon *polygonShape) boundingRadius() float64 {
+	return polygon.polygonBoundingRadius
+}
+
+func (polygon *polygonShape) signedDistance(x float64, y float64) (float64, float64, float64) {
+	closestDistanceSquared := math.Inf(1)
+	closestEdgeIndex := 0
+	closestX, closestY := 0.0, 0.0
+	inside := false
+	for vertexIndex, a := range polygon.vertices {
+		b := polygon.vertices[(vertexIndex+1)%len(polygon.vertices)]
+
+		// Closest point on the edge from a to b
+		edgeX, edgeY := b[0]-a[0], b[1]-a[1]
+		edgeLengthSquared := edgeX*edgeX + edgeY*edgeY
+		t := 0.0
+		if edgeLengthSquared > 0 {
+			t = min(max(((x-a[0])*edgeX+(y-a[1])*edgeY)/edgeLengthSquared, 0), 1)
+		}
+		pointX, pointY := a[0]+t*edgeX, a[1]+t*edgeY
+		distanceSquared := (x-pointX)*(x-pointX) + (y-pointY)*(y-pointY)
+		if distanceSquared < closestDistanceSquared {
+			closestDistanceSquared = distanceSquared
+			closestEdgeIndex = vertexIndex
+			closestX, closestY = pointX, pointY
+		}
+
+		// Even-odd rule, counting crossings of a ray in the positive x direction
+		if (a[1] > y) != (b[1] > y) && x < a[0]+(y-a[1])*edgeX/edgeY {
+			inside = !inside
+		}
+	}
+
+	distance := math.Sqrt(closestDistanceSquared)
+	if distance == 0 {
+		return 0, polygon.normals[closestEdgeIndex][0], polygon.normals[closestEdgeIndex][1]
+	}
+	if inside {
+		return -distance, (closestX - x) / distance, (closestY - y) / distance
+	}
+	return distance, (x - closestX) / distance, (y - closestY) / distance
+}
+
+func (polygon *polygonShape) outline() [][2]float64 {
+	return polygon.vertices
+}
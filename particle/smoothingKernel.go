@@ -1,31 +1,308 @@
 package particle
 
 import (
+	"log"
 	"math"
 )
 
-const (
-	exponent float64 = 2
-)
+// A SmoothingKernel is a radially symmetric weighting function that is zero beyond its radius.
+//
+// All kernels are normalized so that they integrate to one over the (two or three dimensional) simulation space.
+type SmoothingKernel interface {
+	// The radius beyond which the kernel is zero
+	Radius() float64
+
+	// The value of the kernel at the given distance
+	Value(distance float64) float64
+
+	// The derivative of the kernel with respect to distance.
+	//
+	// The full gradient of the kernel is this value multiplied by the unit vector along the displacement.
+	// For all kernels provided this derivative is never positive.
+	Gradient(distance float64) float64
+
+	// The Laplacian of the kernel at the given distance.
+	//
+	// Kernels with a cusp at zero distance (e.g. Power and Spiky) have a singular Laplacian there, which is returned as -Inf.
+	Laplacian(distance float64) float64
+}
+
+// Create the smoothing kernel with the given name, as specified in the SimulationConfig.
+//
+// powerExponent is only used by the "Power" kernel. The "Viscosity" kernel is singular at zero distance, so is only suitable for viscosity.
+func newSmoothingKernel(kernelName string, kernelRadius float64, powerExponent float64, dimensions int) SmoothingKernel {
+	switch kernelName {
+	case "Power":
+		return newPowerKernel(kernelRadius, powerExponent, dimensions)
+	case "Poly6":
+		return newPoly6Kernel(kernelRadius, dimensions)
+	case "Spiky":
+		return newSpikyKernel(kernelRadius, dimensions)
+	case "CubicSpline":
+		return newCubicSplineKernel(kernelRadius, dimensions)
+	case "QuinticSpline":
+		return newQuinticSplineKernel(kernelRadius, dimensions)
+	case "WendlandC2":
+		return newWendlandC2Kernel(kernelRadius, dimensions)
+	case "WendlandC4":
+		return newWendlandC4Kernel(kernelRadius, dimensions)
+	case "Viscosity":
+		return newViscosityKernel(kernelRadius, dimensions)
+	default:
+		log.Panicf("unknown smoothing kernel %q", kernelName)
+	}
+	return nil
+}
 
+// A smoothing kernel defined by a shape function of the normalized distance q = distance / kernelRadius.
+//
+// The shape and its derivatives (with respect to q) need only be defined on [0, 1], as the kernel is zero for q >= 1.
 type smoothingKernelStructure struct {
 	kernelRadius        float64
 	normalizationFactor float64
+	dimensions          int
+
+	shape                 func(q float64) float64
+	shapeDerivative       func(q float64) float64
+	shapeSecondDerivative func(q float64) float64
+
+	// The Laplacian of the shape, for kernels where it is simpler than the shape itself. If nil, it is found from the derivatives
+	shapeLaplacian func(q float64) float64
+}
+
+func (kernel *smoothingKernelStructure) Radius() float64 {
+	return kernel.kernelRadius
+}
+
+func (kernel *smoothingKernelStructure) Value(distance float64) float64 {
+	if distance >= kernel.kernelRadius {
+		return 0
+	}
+	return kernel.normalizationFactor * kernel.shape(distance/kernel.kernelRadius)
+}
+
+func (kernel *smoothingKernelStructure) Gradient(distance float64) float64 {
+	if distance >= kernel.kernelRadius {
+		return 0
+	}
+	return kernel.normalizationFactor * kernel.shapeDerivative(distance/kernel.kernelRadius) / kernel.kernelRadius
+}
+
+func (kernel *smoothingKernelStructure) Laplacian(distance float64) float64 {
+	if distance >= kernel.kernelRadius {
+		return 0
+	}
+
+	q := distance / kernel.kernelRadius
+	if kernel.shapeLaplacian != nil {
+		return kernel.normalizationFactor * kernel.shapeLaplacian(q) / (kernel.kernelRadius * kernel.kernelRadius)
+	}
+
+	// In d dimensions the Laplacian of a radial function is f'' + (d-1) f'/r.
+	// At r=0 the second term tends to (d-1) f''(0) if f'(0) = 0, and is singular otherwise
+	laplacian := kernel.shapeSecondDerivative(q)
+	if q > 0 {
+		laplacian += float64(kernel.dimensions-1) * kernel.shapeDerivative(q) / q
+	} else if derivative := kernel.shapeDerivative(0); derivative != 0 {
+		return math.Copysign(math.Inf(1), derivative)
+	} else {
+		laplacian *= float64(kernel.dimensions)
+	}
+	return kernel.normalizationFactor * laplacian / (kernel.kernelRadius * kernel.kernelRadius)
+}
+
+// Get the normalization factor of a kernel in the given number of dimensions,
+// from the normalizations of the shape function over the unit disk and the unit ball
+func kernelNormalization(dimensions int, kernelRadius float64, normalization2D float64, normalization3D float64) float64 {
+	if dimensions == 3 {
+		return normalization3D / (kernelRadius * kernelRadius * kernelRadius)
+	}
+	return normalization2D / (kernelRadius * kernelRadius)
+}
+
+// The kernel (1-q)^exponent
+func newPowerKernel(kernelRadius float64, exponent float64, dimensions int) *smoothingKernelStructure {
+	return &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, (exponent+1)*(exponent+2)/(2*math.Pi), (exponent+1)*(exponent+2)*(exponent+3)/(8*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			return math.Pow(1-q, exponent)
+		},
+		shapeDerivative: func(q float64) float64 {
+			return -exponent * math.Pow(1-q, exponent-1)
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			return exponent * (exponent - 1) * math.Pow(1-q, exponent-2)
+		},
+	}
 }
 
-func newSmoothingKernel(kernelRadius float64) *smoothingKernelStructure {
+// The Poly6 kernel of Müller et al. (2003), (1-q^2)^3
+func newPoly6Kernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
 	return &smoothingKernelStructure{
 		kernelRadius:        kernelRadius,
-		normalizationFactor: ((exponent*exponent + 3*exponent + 2) / (2 * math.Pi * math.Pow(kernelRadius, exponent+2))),
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 4/math.Pi, 315/(64*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			return math.Pow(1-q*q, 3)
+		},
+		shapeDerivative: func(q float64) float64 {
+			return -6 * q * math.Pow(1-q*q, 2)
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			return -6*math.Pow(1-q*q, 2) + 24*q*q*(1-q*q)
+		},
 	}
 }
 
-func (kernel *smoothingKernelStructure) kernel(displacement float64) float64 {
-	displacement = min(displacement, kernel.kernelRadius)
-	return kernel.normalizationFactor * math.Pow(kernel.kernelRadius-displacement, exponent)
+// The Spiky kernel of Müller et al. (2003), (1-q)^3
+func newSpikyKernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	spikyKernel := newPowerKernel(kernelRadius, 3, dimensions)
+	spikyKernel.normalizationFactor = kernelNormalization(dimensions, kernelRadius, 10/math.Pi, 15/math.Pi)
+	return spikyKernel
 }
 
-func (kernel *smoothingKernelStructure) kernelGradientMagnitude(displacement float64) float64 {
-	displacement = min(displacement, kernel.kernelRadius)
-	return exponent * kernel.normalizationFactor * math.Pow(kernel.kernelRadius-displacement, exponent-1)
+// The cubic B-spline kernel of Monaghan and Lattanzio (1985), scaled so the support is exactly the kernel radius
+func newCubicSplineKernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	return &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 40/(7*math.Pi), 8/math.Pi),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			if q <= 0.5 {
+				return 6*(q*q*q-q*q) + 1
+			}
+			return 2 * math.Pow(1-q, 3)
+		},
+		shapeDerivative: func(q float64) float64 {
+			if q <= 0.5 {
+				return 18*q*q - 12*q
+			}
+			return -6 * math.Pow(1-q, 2)
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			if q <= 0.5 {
+				return 36*q - 12
+			}
+			return 12 * (1 - q)
+		},
+	}
+}
+
+// The quintic spline kernel of Morris et al. (1997), scaled so the support is exactly the kernel radius
+func newQuinticSplineKernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	// The quintic spline is a sum of the terms (k-s)^5, each truncated at zero, with s = 3q
+	splineTerms := []struct {
+		coefficient float64
+		offset      float64
+	}{
+		{1, 3},
+		{-6, 2},
+		{15, 1},
+	}
+
+	return &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 63/(478*math.Pi), 9/(40*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			result := 0.0
+			for _, term := range splineTerms {
+				result += term.coefficient * math.Pow(max(term.offset-3*q, 0), 5)
+			}
+			return result
+		},
+		shapeDerivative: func(q float64) float64 {
+			result := 0.0
+			for _, term := range splineTerms {
+				result -= 15 * term.coefficient * math.Pow(max(term.offset-3*q, 0), 4)
+			}
+			return result
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			result := 0.0
+			for _, term := range splineTerms {
+				result += 180 * term.coefficient * math.Pow(max(term.offset-3*q, 0), 3)
+			}
+			return result
+		},
+	}
+}
+
+// The Wendland C2 kernel, (1-q)^4 (1+4q)
+func newWendlandC2Kernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	return &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 7/math.Pi, 21/(2*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			return math.Pow(1-q, 4) * (1 + 4*q)
+		},
+		shapeDerivative: func(q float64) float64 {
+			return -20 * q * math.Pow(1-q, 3)
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			return -20 * math.Pow(1-q, 2) * (1 - 4*q)
+		},
+	}
+}
+
+// The Wendland C4 kernel, (1-q)^6 (1+6q+35q^2/3)
+func newWendlandC4Kernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	return &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 9/math.Pi, 495/(32*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			return math.Pow(1-q, 6) * (1 + 6*q + 35*q*q/3)
+		},
+		shapeDerivative: func(q float64) float64 {
+			return -56 * q * math.Pow(1-q, 5) * (1 + 5*q) / 3
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			return -56 * math.Pow(1-q, 4) * (1 + 4*q - 35*q*q) / 3
+		},
+	}
+}
+
+// The viscosity kernel of Müller et al. (2003), whose Laplacian is proportional to 1-q.
+//
+// The Laplacian is positive everywhere, so viscosity calculated from it always reduces the relative velocity of two particles,
+// whereas the Laplacian of most kernels is negative near zero distance. The kernel itself is singular at zero distance.
+// The original kernel is for three dimensions, so in two dimensions the shape is instead the solution of ∇^2 f = 1-q
+// with f(1) = f'(1) = 0.
+func newViscosityKernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	viscosityKernel := &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 40/math.Pi, 15/(2*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			return q*q/4 - q*q*q/9 - math.Log(q)/6 - 5.0/36.0
+		},
+		shapeDerivative: func(q float64) float64 {
+			return q/2 - q*q/3 - 1/(6*q)
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			return 0.5 - 2*q/3 + 1/(6*q*q)
+		},
+		shapeLaplacian: func(q float64) float64 {
+			return 1 - q
+		},
+	}
+	if dimensions == 3 {
+		viscosityKernel.shape = func(q float64) float64 {
+			return -q*q*q/2 + q*q + 1/(2*q) - 1
+		}
+		viscosityKernel.shapeDerivative = func(q float64) float64 {
+			return -3*q*q/2 + 2*q - 1/(2*q*q)
+		}
+		viscosityKernel.shapeSecondDerivative = func(q float64) float64 {
+			return -3*q + 2 + 1/(q*q*q)
+		}
+		viscosityKernel.shapeLaplacian = func(q float64) float64 {
+			return 6 * (1 - q)
+		}
+	}
+	return viscosityKernel
 }
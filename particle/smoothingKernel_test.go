@@ -0,0 +1,110 @@
+package particle
+
+import (
+	"math"
+	"testing"
+)
+
+var testKernelNames = []string{"Power", "Poly6", "Spiky", "CubicSpline", "QuinticSpline", "WendlandC2", "WendlandC4", "Viscosity"}
+
+const testKernelRadius = 10.0
+
+// Create every kernel that can be selected by name, along with the cohesion kernel used for surface tension
+func createTestKernels(dimensions int) map[string]SmoothingKernel {
+	kernels := map[string]SmoothingKernel{"Cohesion": newCohesionKernel(testKernelRadius, dimensions)}
+	for _, kernelName := range testKernelNames {
+		kernels[kernelName] = newSmoothingKernel(kernelName, testKernelRadius, 2, dimensions)
+	}
+	return kernels
+}
+
+// Integrate the kernel over the disk (or, in three dimensions, the ball) of its radius using Simpson's rule along the radius.
+// The shell at zero distance has no area, so it is skipped, as some kernels are singular there
+func integrateKernel(kernel SmoothingKernel, dimensions int) float64 {
+	const numIntervals = 10000
+	intervalWidth := kernel.Radius() / numIntervals
+	integral := 0.0
+	for i := 1; i <= numIntervals; i += 1 {
+		distance := float64(i) * intervalWidth
+		weight := 2.0
+		if i == numIntervals {
+			weight = 1
+		} else if i%2 == 1 {
+			weight = 4
+		}
+		shellArea := 2 * math.Pi * distance
+		if dimensions == 3 {
+			shellArea = 4 * math.Pi * distance * distance
+		}
+		integral += weight * kernel.Value(distance) * shellArea
+	}
+	return integral * intervalWidth / 3
+}
+
+// Every kernel must be normalized, so that the density of a uniform fluid is its rest density
+func TestKernelsIntegrateToOne(t *testing.T) {
+	for _, dimensions := range []int{2, 3} {
+		for kernelName, kernel := range createTestKernels(dimensions) {
+			if integral := integrateKernel(kernel, dimensions); math.Abs(integral-1) > 1e-6 {
+				t.Errorf("%v kernel integrates to %v in %v dimensions", kernelName, integral, dimensions)
+			}
+		}
+	}
+}
+
+// The gradient of every kernel must be the derivative of its value, or pressure will not balance density
+func TestKernelGradientsMatchFiniteDifferences(t *testing.T) {
+	const stepSize = 1e-5
+	for _, dimensions := range []int{2, 3} {
+		for kernelName, kernel := range createTestKernels(dimensions) {
+			for q := 0.05; q < 1; q += 0.1 {
+				distance := q * testKernelRadius
+				finiteDifference := (kernel.Value(distance+stepSize) - kernel.Value(distance-stepSize)) / (2 * stepSize)
+				gradient := kernel.Gradient(distance)
+				if math.Abs(gradient-finiteDifference) > 1e-6*math.Pow(testKernelRadius, -float64(dimensions+1)) {
+					t.Errorf("%v kernel gradient at distance %v in %v dimensions is %v, but the finite difference is %v",
+						kernelName, distance, dimensions, gradient, finiteDifference)
+				}
+			}
+		}
+	}
+}
+
+// The Laplacian of every kernel must match the finite differences of its value, as the Laplacian of a radial function f is f_rr + (d-1) f_r / r
+func TestKernelLaplaciansMatchFiniteDifferences(t *testing.T) {
+	const stepSize = 1e-4
+	for _, dimensions := range []int{2, 3} {
+		for kernelName, kernel := range createTestKernels(dimensions) {
+			for q := 0.05; q < 1; q += 0.1 {
+				distance := q * testKernelRadius
+				firstDifference := (kernel.Value(distance+stepSize) - kernel.Value(distance-stepSize)) / (2 * stepSize)
+				secondDifference := (kernel.Value(distance+stepSize) - 2*kernel.Value(distance) + kernel.Value(distance-stepSize)) / (stepSize * stepSize)
+				finiteDifference := secondDifference + float64(dimensions-1)*firstDifference/distance
+				laplacian := kernel.Laplacian(distance)
+				if math.Abs(laplacian-finiteDifference) > 1e-5*(math.Abs(laplacian)+math.Abs(kernel.Laplacian(testKernelRadius/2))) {
+					t.Errorf("%v kernel Laplacian at distance %v in %v dimensions is %v, but the finite difference is %v",
+						kernelName, distance, dimensions, laplacian, finiteDifference)
+				}
+			}
+		}
+	}
+}
+
+// The Laplacian at zero distance must be the limit of the Laplacian as the distance goes to zero,
+// which is infinite for kernels with a cusp at zero
+func TestKernelLaplaciansAtZero(t *testing.T) {
+	for _, dimensions := range []int{2, 3} {
+		for kernelName, kernel := range createTestKernels(dimensions) {
+			atZero := kernel.Laplacian(0)
+			nearZero := kernel.Laplacian(1e-6 * testKernelRadius)
+			scale := math.Abs(kernel.Laplacian(testKernelRadius / 2))
+			if math.IsInf(atZero, -1) {
+				if nearZero > -1e4*scale {
+					t.Errorf("%v kernel Laplacian in %v dimensions is infinite at zero, but %v near zero", kernelName, dimensions, nearZero)
+				}
+			} else if math.Abs(atZero-nearZero) > 1e-4*(math.Abs(atZero)+scale) {
+				t.Errorf("%v kernel Laplacian in %v dimensions is %v at zero, but %v near zero", kernelName, dimensions, atZero, nearZero)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+)
+
+// A Solver advances the state of every particle in a collection by a single step.
+//
+// The explicit solver calculates pressure directly from the equation of state and hands the resulting
+// accelerations to an Integrator. The remaining solvers instead iterate on the pressure within each step
+// to enforce incompressibility.
+type Solver interface {
+	Step(particleCollection *ParticleCollection, stepSize float64)
+}
+
+// Create the solver specified in the SimulationConfig
+func newSolver(simulationConfig *config.SimulationConfig) Solver {
+	switch simulationConfig.Solver {
+	case "Explicit":
+		return &explicitSolver{
+			integrator: newIntegrator(simulationConfig.Integrator),
+		}
+	case "PCISPH":
+		return &pcisphSolver{}
+	case "DFSPH":
+		return &dfsphSolver{}
+	case "PBF":
+		return &pbfSolver{}
+	default:
+		log.Panicf("unknown solver %q", simulationConfig.Solver)
+	}
+	return nil
+}
+
+// The explicit solver, in which all forces (including pressure) are calculated once per evaluation and integrated directly
+type explicitSolver struct {
+	integrator Integrator
+}
+
+func (solver *explicitSolver) Step(particleCollection *ParticleCollection, stepSize float64) {
+	solver.integrator.Integrate(particleCollection, stepSize)
+}
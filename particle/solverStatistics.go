@@ -0,0 +1,21 @@
+package particle
+
+// Statistics from the most recent step of the solver.
+//
+// Only the iterative solvers report statistics, and each only reports the quantities it solves for.
+type SolverStatistics struct {
+	// The number of iterations taken to correct the density, and the final relative density error.
+	// PCISPH reports the largest error of any particle, while DFSPH reports the average
+	DensityIterations int
+	DensityResidual   float64
+
+	// The number of iterations taken to make the velocity field divergence free, and the final
+	// average relative density change over a step due to the remaining divergence
+	DivergenceIterations int
+	DivergenceResidual   float64
+}
+
+// Get the statistics from the most recent step of the solver
+func (particleCollection *ParticleCollection) SolverStatistics() SolverStatistics {
+	return particleCollection.solverStatistics
+}
@@ -2,14 +2,19 @@ package particle
 
 import (
 	"math"
+	"slices"
 )
 
 type spatialHashingStructure struct {
-	// Cell Sizes - equal to the smoothing kernel radius
-	cellSize float64
+	// Cell Sizes along each axis - equal to the given cell size.
+	//
+	// Along a periodic axis the cell size is instead increased slightly so that a whole number
+	// of cells spans the simulation, and the cell coordinates wrap around at the periodic seam
+	cellSizes []float64
 
-	numCellsX int
-	numCellsY int
+	numCells        []int
+	periodic        []bool
+	simulationSizes []float64
 
 	// Number of bins to hash cells into
 	bins int
@@ -44,32 +49,75 @@ type spatialHashingStructure struct {
 	particleHashes []int
 }
 
-func createSpatialHashingStructure(cellSize float64, spatialHashingBins int, numParticles int, simulationWidth int32, simulationHeight int32) *spatialHashingStructure {
-	numCellsX := int(math.Ceil(float64(simulationWidth) / cellSize))
-	numCellsY := int(math.Ceil(float64(simulationHeight) / cellSize))
-	return &spatialHashingStructure{
-		cellSize:           cellSize,
-		numCellsX:          numCellsX,
-		numCellsY:          numCellsY,
+// Create a spatial hashing structure over a simulation with the given size along each axis,
+// which may have either two or three axes
+func createSpatialHashingStructure(cellSize float64, spatialHashingBins int, numParticles int, simulationSizes []float64, periodic []bool) *spatialHashingStructure {
+	sh := &spatialHashingStructure{
+		cellSizes:          make([]float64, len(simulationSizes)),
+		numCells:           make([]int, len(simulationSizes)),
+		periodic:           periodic,
+		simulationSizes:    simulationSizes,
 		bins:               spatialHashingBins,
 		partialSums:        make([]int, spatialHashingBins+1),
 		denseParticleArray: make([]int, numParticles),
 		particleHashes:     make([]int, numParticles),
 	}
+	for direction, simulationSize := range sh.simulationSizes {
+		if sh.periodic[direction] {
+			sh.numCells[direction] = max(int(math.Floor(simulationSize/cellSize)), 1)
+			sh.cellSizes[direction] = simulationSize / float64(sh.numCells[direction])
+		} else {
+			sh.numCells[direction] = int(math.Ceil(simulationSize / cellSize))
+			sh.cellSizes[direction] = cellSize
+		}
+	}
+	return sh
 }
 
-func (sh *spatialHashingStructure) hashCoordinate(x int, y int) int {
-	hashCoefficients := []int{92837111, 689287499}
-	particleHash := hashCoefficients[xDIR]*x + hashCoefficients[yDIR]*y
+// Resize the working arrays for the given number of particles
+func (sh *spatialHashingStructure) resize(numParticles int) {
+	sh.denseParticleArray = slices.Grow(sh.denseParticleArray[:0], numParticles)[:numParticles]
+	sh.particleHashes = slices.Grow(sh.particleHashes[:0], numParticles)[:numParticles]
+}
+
+func (sh *spatialHashingStructure) hashCoordinate(coordinates [3]int) int {
+	hashCoefficients := []int{92837111, 689287499, 283923481}
+	particleHash := hashCoefficients[xDIR]*coordinates[xDIR] + hashCoefficients[yDIR]*coordinates[yDIR] + hashCoefficients[zDIR]*coordinates[zDIR]
 	if particleHash < 0 {
 		particleHash *= -1
 	}
 	return particleHash % sh.bins
 }
 
-func (sh *spatialHashingStructure) convertParticleToCoordinate(particle *Particle) (int, int) {
+// Get the cell coordinates of a particle. In two dimensions the z coordinate is always zero
+func (sh *spatialHashingStructure) convertParticleToCoordinate(particle *Particle) [3]int {
 	hashingVec := particle.PredictedPosition
-	return int(hashingVec.AtVec(xDIR) / sh.cellSize), int(hashingVec.AtVec(yDIR) / sh.cellSize)
+	var coordinates [3]int
+	for direction := range sh.simulationSizes {
+		coordinates[direction] = sh.convertPositionToCellCoordinate(hashingVec.AtVec(direction), direction)
+	}
+	return coordinates
+}
+
+// Get the cell coordinate of a position along a single axis
+func (sh *spatialHashingStructure) convertPositionToCellCoordinate(position float64, direction int) int {
+	if sh.periodic[direction] {
+		position = wrapCoordinate(position, sh.simulationSizes[direction])
+	}
+	coordinate := int(math.Floor(position / sh.cellSizes[direction]))
+	if sh.periodic[direction] {
+		coordinate = min(coordinate, sh.numCells[direction]-1)
+	}
+	return coordinate
+}
+
+// Wrap a cell coordinate around the periodic seam, if the axis is periodic
+func (sh *spatialHashingStructure) wrapCellCoordinate(coordinate int, direction int) int {
+	if direction >= len(sh.periodic) || !sh.periodic[direction] {
+		return coordinate
+	}
+	numCells := sh.numCells[direction]
+	return ((coordinate % numCells) + numCells) % numCells
 }
 
 func (sh *spatialHashingStructure) updateSpatialHashing(particles []*Particle) {
@@ -117,23 +165,68 @@ func (sh *spatialHashingStructure) getAllNeighboringParticleIndices(particle *Pa
 	neighboringParticleIndices := make([]int, 0)
 
 	// Find the cell coordinates of this particle
-	centerCellXCoordinate, centerCellYCoordinate := sh.convertParticleToCoordinate(particle)
-	// Then check the cells left, right, up, and down.
-	// Skip any cells that lie outside the simulation (think boundaries of screen)
+	centerCellCoordinates := sh.convertParticleToCoordinate(particle)
+	// Then check the cells left, right, up, and down (and in front and behind, in three dimensions).
+	// Cells outside the simulation are still checked, as predicted positions may lie outside the simulation.
+	// Each bin is only checked once, as with periodic axes (or hash collisions) several cells may share a bin
+	maxDz := 0
+	if len(sh.simulationSizes) == 3 {
+		maxDz = 1
+	}
+	visitedBins := make([]int, 0, 27)
 	for dx := -1; dx <= 1; dx += 1 {
-		if centerCellXCoordinate+dx < 0 || centerCellXCoordinate+dx > sh.numCellsX {
-			continue
-		}
-
 		for dy := -1; dy <= 1; dy += 1 {
-			if centerCellYCoordinate+dy < 0 || centerCellYCoordinate+dy > sh.numCellsY {
-				continue
+			for dz := -maxDz; dz <= maxDz; dz += 1 {
+				cellCoordinates := [3]int{
+					sh.wrapCellCoordinate(centerCellCoordinates[xDIR]+dx, xDIR),
+					sh.wrapCellCoordinate(centerCellCoordinates[yDIR]+dy, yDIR),
+					sh.wrapCellCoordinate(centerCellCoordinates[zDIR]+dz, zDIR),
+				}
+				binIndex := sh.hashCoordinate(cellCoordinates)
+				if slices.Contains(visitedBins, binIndex) {
+					continue
+				}
+				visitedBins = append(visitedBins, binIndex)
+
+				// TODO: Fix this bit up, it would be better to collect all the indices first then append at once, but this should be okay...?
+				neighboringParticleIndices = append(neighboringParticleIndices, sh.getParticleIndicesInBin(binIndex)...)
 			}
-
-			// TODO: Fix this bit up, it would be better to collect all the indices first then append at once, but this should be okay...?
-			neighboringParticleIndices = append(neighboringParticleIndices, sh.getParticleIndicesInBin(sh.hashCoordinate(centerCellXCoordinate+dx, centerCellYCoordinate+dy))...)
 		}
 	}
 
 	return neighboringParticleIndices
 }
+
+// Get the indices of all particles in the cells within the given radius of a point in the x-y plane,
+// and one cell further, as particles may have moved since they were hashed. The particles themselves are
+// not checked against the radius. In three dimensions the cells through the entire depth of the simulation are included.
+func (sh *spatialHashingStructure) getParticleIndicesNearPoint(positionX float64, positionY float64, radius float64) []int {
+	centerCellX := sh.convertPositionToCellCoordinate(positionX, xDIR)
+	centerCellY := sh.convertPositionToCellCoordinate(positionY, yDIR)
+	extentX := int(math.Ceil(radius/sh.cellSizes[xDIR])) + 1
+	extentY := int(math.Ceil(radius/sh.cellSizes[yDIR])) + 1
+	minCellZ, maxCellZ := 0, 0
+	if len(sh.simulationSizes) == 3 {
+		minCellZ, maxCellZ = -1, sh.numCells[zDIR]
+	}
+
+	particleIndices := make([]int, 0)
+	visitedBins := make(map[int]bool)
+	for cellX := centerCellX - extentX; cellX <= centerCellX+extentX; cellX += 1 {
+		for cellY := centerCellY - extentY; cellY <= centerCellY+extentY; cellY += 1 {
+			for cellZ := minCellZ; cellZ <= maxCellZ; cellZ += 1 {
+				binIndex := sh.hashCoordinate([3]int{
+					sh.wrapCellCoordinate(cellX, xDIR),
+					sh.wrapCellCoordinate(cellY, yDIR),
+					sh.wrapCellCoordinate(cellZ, zDIR),
+				})
+				if visitedBins[binIndex] {
+					continue
+				}
+				visitedBins[binIndex] = true
+				particleIndices = append(particleIndices, sh.getParticleIndicesInBin(binIndex)...)
+			}
+		}
+	}
+	return particleIndices
+}
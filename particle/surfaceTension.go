@@ -0,0 +1,97 @@
+package particle
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Surface tension follows Akinci et al. (2013), "Versatile Surface Tension and Adhesion for SPH Fluids".
+//
+// Two forces act between every pair of neighboring particles: a cohesion force that pulls particles together
+// (and pushes them apart at very short range), and a curvature force that acts to minimize the surface area
+// by pulling particles on the surface towards the fluid. Both are scaled by a symmetric correction factor
+// that strengthens the forces for particles with a neighborhood deficiency, i.e. those on the surface.
+
+// The cohesion kernel of Akinci et al. (2013).
+//
+// The original normalization of 32/π does not integrate to one, so the kernel is instead normalized like the other kernels.
+// Before normalization the kernel integrates to 2π 209/71680 in two dimensions and 4π 79/43008 in three dimensions.
+func newCohesionKernel(kernelRadius float64, dimensions int) *smoothingKernelStructure {
+	return &smoothingKernelStructure{
+		kernelRadius:        kernelRadius,
+		normalizationFactor: kernelNormalization(dimensions, kernelRadius, 71680/(209*2*math.Pi), 43008/(79*4*math.Pi)),
+		dimensions:          dimensions,
+		shape: func(q float64) float64 {
+			if q <= 0.5 {
+				return 2*math.Pow(1-q, 3)*math.Pow(q, 3) - 1.0/64.0
+			}
+			return math.Pow(1-q, 3) * math.Pow(q, 3)
+		},
+		shapeDerivative: func(q float64) float64 {
+			derivative := 3 * q * q * (1 - q) * (1 - q) * (1 - 2*q)
+			if q <= 0.5 {
+				return 2 * derivative
+			}
+			return derivative
+		},
+		shapeSecondDerivative: func(q float64) float64 {
+			secondDerivative := 6 * q * (1 - q) * (1 - 5*q + 5*q*q)
+			if q <= 0.5 {
+				return 2 * secondDerivative
+			}
+			return secondDerivative
+		},
+	}
+}
+
+// Calculate the surface normal of each particle, storing the result in particleCollection.surfaceNormals.
+//
+// The normal is the scaled gradient of the smoothed color field, which is large only near the surface and points out of the fluid.
+func (particleCollection *ParticleCollection) calculateSurfaceNormalWorker(particleIndexChannel <-chan int) {
+	displacementVec := particleCollection.newVector()
+	for particleIndex := range particleIndexChannel {
+		targetParticle := particleCollection.Particles[particleIndex]
+		surfaceNormal := particleCollection.surfaceNormals[particleIndex]
+		surfaceNormal.Zero()
+
+		neighboringParticleIndices := particleCollection.spatialHashing.getAllNeighboringParticleIndices(targetParticle)
+		for _, neighborIndex := range neighboringParticleIndices {
+			if particleIndex == neighborIndex {
+				continue
+			}
+
+			particleCollection.calculateDisplacement(displacementVec, targetParticle.PredictedPosition, particleCollection.Particles[neighborIndex].PredictedPosition)
+			displacementMagnitude := displacementVec.Norm(2)
+			if displacementMagnitude == 0 {
+				continue
+			}
+
+			gradient := particleCollection.densityKernel.Gradient(displacementMagnitude)
+			scale := particleCollection.particlePhase(neighborIndex).ParticleMass / particleCollection.densities[neighborIndex] * gradient / displacementMagnitude
+			surfaceNormal.AddScaledVec(surfaceNormal, scale, displacementVec)
+		}
+		surfaceNormal.ScaleVec(particleCollection.simulationConfig.SmoothingKernelRadius, surfaceNormal)
+	}
+}
+
+// Add the surface tension acceleration on the target particle due to a single neighbor.
+//
+// direction is the unit vector from the neighbor to the target particle, and distance is the distance between them.
+// Neighbors outside the cohesion kernel radius have no effect.
+func (particleCollection *ParticleCollection) addSurfaceTensionAcceleration(acceleration *mat.VecDense, particleIndex int, neighborIndex int, direction *mat.VecDense, distance float64) {
+	if distance >= particleCollection.cohesionKernel.Radius() {
+		return
+	}
+	simulationConfig := particleCollection.simulationConfig
+	targetPhase := particleCollection.particlePhase(particleIndex)
+	neighborPhase := particleCollection.particlePhase(neighborIndex)
+	correctionFactor := (targetPhase.RestDensity + neighborPhase.RestDensity) / (particleCollection.densities[particleIndex] + particleCollection.densities[neighborIndex])
+
+	cohesionMagnitude := -simulationConfig.SurfaceTensionCoefficient * neighborPhase.ParticleMass * particleCollection.cohesionKernel.Value(distance)
+	acceleration.AddScaledVec(acceleration, correctionFactor*cohesionMagnitude, direction)
+
+	curvatureScale := -simulationConfig.SurfaceTensionCoefficient * correctionFactor
+	acceleration.AddScaledVec(acceleration, curvatureScale, particleCollection.surfaceNormals[particleIndex])
+	acceleration.AddScaledVec(acceleration, -curvatureScale, particleCollection.surfaceNormals[neighborIndex])
+}
@@ -0,0 +1,158 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"log"
+	"math"
+)
+
+// A ViscosityModel relates the viscosity of a fluid to the local shear rate
+type ViscosityModel interface {
+	// The viscosity of the fluid at the given shear rate, which is never negative
+	Viscosity(shearRate float64) float64
+}
+
+// Create the viscosity model of the phase, as specified by its ViscosityModel.
+// The viscosity of the phase is the consistency, zero shear viscosity, or plastic viscosity of the model
+func newViscosityModel(phase config.PhaseConfig) ViscosityModel {
+	switch phase.ViscosityModel {
+	case "Newtonian":
+		return &newtonianViscosityModel{viscosity: phase.Viscosity}
+	case "PowerLaw":
+		return &powerLawViscosityModel{
+			consistency:       phase.Viscosity,
+			flowBehaviorIndex: phase.FlowBehaviorIndex,
+		}
+	case "Carreau":
+		return &carreauViscosityModel{
+			zeroShearViscosity:     phase.Viscosity,
+			infiniteShearViscosity: phase.InfiniteShearViscosity,
+			relaxationTime:         phase.RelaxationTime,
+			flowBehaviorIndex:      phase.FlowBehaviorIndex,
+		}
+	case "Cross":
+		return &crossViscosityModel{
+			zeroShearViscosity:     phase.Viscosity,
+			infiniteShearViscosity: phase.InfiniteShearViscosity,
+			relaxationTime:         phase.RelaxationTime,
+			flowBehaviorIndex:      phase.FlowBehaviorIndex,
+		}
+	case "Bingham":
+		return &binghamViscosityModel{
+			plasticViscosity: phase.Viscosity,
+			yieldStress:      phase.YieldStress,
+			regularization:   phase.YieldRegularization,
+		}
+	default:
+		log.Panicf("unknown viscosity model %q", phase.ViscosityModel)
+	}
+	return nil
+}
+
+// The viscosity is constant, regardless of the shear rate
+type newtonianViscosityModel struct {
+	viscosity float64
+}
+
+func (viscosityModel *newtonianViscosityModel) Viscosity(shearRate float64) float64 {
+	return viscosityModel.viscosity
+}
+
+// The Ostwald-de Waele power law, K γ̇^(n-1).
+//
+// The viscosity is unbounded as the shear rate approaches zero for shear thinning fluids (n < 1)
+type powerLawViscosityModel struct {
+	consistency       float64
+	flowBehaviorIndex float64
+}
+
+func (viscosityModel *powerLawViscosityModel) Viscosity(shearRate float64) float64 {
+	// An inviscid fluid stays inviscid at zero shear rate, rather than being zero times infinity
+	if viscosityModel.consistency == 0 {
+		return 0
+	}
+	return viscosityModel.consistency * math.Pow(shearRate, viscosityModel.flowBehaviorIndex-1)
+}
+
+// The Carreau model, μ∞ + (μ0 - μ∞)(1 + (λγ̇)^2)^((n-1)/2).
+//
+// This behaves as a Newtonian fluid at low shear rates, and as a power law fluid at high shear rates
+type carreauViscosityModel struct {
+	zeroShearViscosity     float64
+	infiniteShearViscosity float64
+	relaxationTime         float64
+	flowBehaviorIndex      float64
+}
+
+func (viscosityModel *carreauViscosityModel) Viscosity(shearRate float64) float64 {
+	scaledShearRate := viscosityModel.relaxationTime * shearRate
+	thinning := math.Pow(1+scaledShearRate*scaledShearRate, (viscosityModel.flowBehaviorIndex-1)/2)
+	return viscosityModel.infiniteShearViscosity + (viscosityModel.zeroShearViscosity-viscosityModel.infiniteShearViscosity)*thinning
+}
+
+// The Cross model, μ∞ + (μ0 - μ∞) / (1 + (λγ̇)^(1-n)).
+//
+// Similar to the Carreau model, but with a sharper transition between the low and high shear rate behavior
+type crossViscosityModel struct {
+	zeroShearViscosity     float64
+	infiniteShearViscosity float64
+	relaxationTime         float64
+	flowBehaviorIndex      float64
+}
+
+func (viscosityModel *crossViscosityModel) Viscosity(shearRate float64) float64 {
+	thinning := 1 / (1 + math.Pow(viscosityModel.relaxationTime*shearRate, 1-viscosityModel.flowBehaviorIndex))
+	return viscosityModel.infiniteShearViscosity + (viscosityModel.zeroShearViscosity-viscosityModel.infiniteShearViscosity)*thinning
+}
+
+// A Bingham plastic, which does not flow until the stress exceeds the yield stress, and then flows as a Newtonian fluid.
+//
+// Following Papanastasiou (1987) the yield is regularized as μp + τy (1 - exp(-m γ̇)) / γ̇, which tends to
+// μp + τy m at zero shear rate rather than being unbounded. Larger m approach the ideal Bingham plastic more closely.
+type binghamViscosityModel struct {
+	plasticViscosity float64
+	yieldStress      float64
+	regularization   float64
+}
+
+func (viscosityModel *binghamViscosityModel) Viscosity(shearRate float64) float64 {
+	if shearRate == 0 {
+		return viscosityModel.plasticViscosity + viscosityModel.yieldStress*viscosityModel.regularization
+	}
+	return viscosityModel.plasticViscosity + viscosityModel.yieldStress*(-math.Expm1(-viscosityModel.regularization*shearRate))/shearRate
+}
+
+// Calculate the viscosity of each particle from the shear rate at the predicted state,
+// storing the result in particleCollection.viscosities.
+//
+// The shear rate is √(2 D:D), where D is the symmetric part of the velocity gradient, the strain rate tensor.
+func (particleCollection *ParticleCollection) calculateViscosityWorker(particleIndexChannel <-chan int) {
+	gradientVec := particleCollection.newVector()
+	velocityDifferential := particleCollection.newVector()
+	for particleIndex := range particleIndexChannel {
+		targetParticle := particleCollection.Particles[particleIndex]
+		velocityGradient := particleCollection.calculateVelocityGradient(particleIndex, gradientVec, velocityDifferential)
+
+		strainRateContraction := 0.0
+		for row := 0; row < particleCollection.dimensions; row += 1 {
+			for column := 0; column < particleCollection.dimensions; column += 1 {
+				strainRate := (velocityGradient[row][column] + velocityGradient[column][row]) / 2
+				strainRateContraction += strainRate * strainRate
+			}
+		}
+		shearRate := math.Sqrt(2 * strainRateContraction)
+
+		viscosity := particleCollection.viscosityModels[targetParticle.Phase].Viscosity(shearRate)
+		particleCollection.viscosities[particleIndex] = min(viscosity, particleCollection.particlePhase(particleIndex).MaximumViscosity)
+	}
+}
+
+// Get the viscosity of the particle with the given index.
+//
+// Newtonian phases always have the viscosity of the phase, so shear rates are only calculated if some phase is not Newtonian.
+func (particleCollection *ParticleCollection) particleViscosity(particleIndex int) float64 {
+	if !particleCollection.nonNewtonian {
+		return particleCollection.particlePhase(particleIndex).Viscosity
+	}
+	return particleCollection.viscosities[particleIndex]
+}
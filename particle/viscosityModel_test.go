@@ -0,0 +1,68 @@
+package particle
+
+import (
+	"hmcalister/SmoothedParticleHydrodynamicsSimulation/config"
+	"math"
+	"testing"
+)
+
+// Each viscosity model must follow its formula, using the parameters of the phase rather than the global options
+func TestViscosityModelsMatchFormulas(t *testing.T) {
+	phase := config.PhaseConfig{
+		Viscosity:              0.2,
+		FlowBehaviorIndex:      0.4,
+		InfiniteShearViscosity: 0.01,
+		RelaxationTime:         3,
+		YieldStress:            0.5,
+		YieldRegularization:    50,
+	}
+	testCases := []struct {
+		viscosityModel string
+		formula        func(shearRate float64) float64
+	}{
+		{"Newtonian", func(shearRate float64) float64 {
+			return 0.2
+		}},
+		{"PowerLaw", func(shearRate float64) float64 {
+			return 0.2 * math.Pow(shearRate, 0.4-1)
+		}},
+		{"Carreau", func(shearRate float64) float64 {
+			return 0.01 + (0.2-0.01)*math.Pow(1+math.Pow(3*shearRate, 2), (0.4-1)/2)
+		}},
+		{"Cross", func(shearRate float64) float64 {
+			return 0.01 + (0.2-0.01)/(1+math.Pow(3*shearRate, 1-0.4))
+		}},
+		{"Bingham", func(shearRate float64) float64 {
+			return 0.2 + 0.5*(1-math.Exp(-50*shearRate))/shearRate
+		}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.viscosityModel, func(t *testing.T) {
+			phase.ViscosityModel = testCase.viscosityModel
+			viscosityModel := newViscosityModel(phase)
+			for _, shearRate := range []float64{0.001, 0.1, 1, 10, 1000} {
+				expected := testCase.formula(shearRate)
+				if viscosity := viscosityModel.Viscosity(shearRate); math.Abs(viscosity-expected) > 1e-9*expected {
+					t.Errorf("viscosity at shear rate %v is %v, but the formula gives %v", shearRate, viscosity, expected)
+				}
+			}
+		})
+	}
+}
+
+// The Bingham plastic must be bounded at zero shear rate, with the limit of its regularized formula
+func TestBinghamViscosityAtZeroShearRate(t *testing.T) {
+	phase := config.PhaseConfig{ViscosityModel: "Bingham", Viscosity: 0.2, YieldStress: 0.5, YieldRegularization: 50}
+	if viscosity := newViscosityModel(phase).Viscosity(0); viscosity != 0.2+0.5*50 {
+		t.Errorf("viscosity at zero shear rate is %v, rather than %v", viscosity, 0.2+0.5*50)
+	}
+}
+
+// A shear thinning power law fluid with no consistency must be inviscid, even at zero shear rate
+func TestInviscidPowerLawAtZeroShearRate(t *testing.T) {
+	phase := config.PhaseConfig{ViscosityModel: "PowerLaw", Viscosity: 0, FlowBehaviorIndex: 0.5}
+	if viscosity := newViscosityModel(phase).Viscosity(0); viscosity != 0 {
+		t.Errorf("viscosity at zero shear rate is %v, rather than zero", viscosity)
+	}
+}